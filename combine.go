@@ -0,0 +1,92 @@
+package fxconfig
+
+import (
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// Combine2 returns an fx.Option which provides a config.Dynamic[Out] and Out
+// combined from the Dynamic Configs of A and B by fn, for a consumer which
+// needs several configs at once, e.g. a server constructor. Out is combined
+// again from the latest configs whenever a reload changes one of them. A
+// reload of a NewGroup changing several of them combines Out once, after all
+// its sections committed, so Out never pairs new sections with old ones.
+func Combine2[A, B, Out any](fn func(A, B) Out) fx.Option {
+	return fx.Provide(func(a config.Dynamic[A], b config.Dynamic[B]) (config.Dynamic[Out], Out, error) {
+		srcA, errA := asDynamic(a)
+		srcB, errB := asDynamic(b)
+
+		return combine(func() Out { return fn(srcA.Load(), srcB.Load()) },
+			[]error{errA, errB}, srcA, srcB)
+	})
+}
+
+// Combine3 returns an fx.Option like Combine2, which combines the Dynamic
+// Configs of A, B and C by fn:
+//
+//	type ServerConfig struct {
+//		DB   DBConfig
+//		HTTP HTTPConfig
+//		Auth AuthConfig
+//	}
+//
+//	fxconfig.Combine3(func(db DBConfig, http HTTPConfig, auth AuthConfig) ServerConfig {
+//		return ServerConfig{DB: db, HTTP: http, Auth: auth}
+//	})
+func Combine3[A, B, C, Out any](fn func(A, B, C) Out) fx.Option {
+	return fx.Provide(func(a config.Dynamic[A], b config.Dynamic[B], c config.Dynamic[C]) (config.Dynamic[Out], Out, error) {
+		srcA, errA := asDynamic(a)
+		srcB, errB := asDynamic(b)
+		srcC, errC := asDynamic(c)
+
+		return combine(func() Out { return fn(srcA.Load(), srcB.Load(), srcC.Load()) },
+			[]error{errA, errB, errC}, srcA, srcB, srcC)
+	})
+}
+
+// combineSource is a source of a combined config.
+type combineSource interface {
+	subscribe(key any, fn func())
+}
+
+// combine returns the Dynamic Config combined by fn, which is combined again
+// after each reload of the sources, unless one of errs, the errors of getting
+// the sources, is set.
+func combine[Out any](fn func() Out, errs []error, sources ...combineSource) (config.Dynamic[Out], Out, error) {
+	var zero Out
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, zero, err
+		}
+	}
+
+	d := &Dynamic[Out]{
+		opts:   &options[Out]{},
+		derive: func() (Out, error) { return fn(), nil },
+	}
+
+	if err := d.init(fn(), nil); err != nil {
+		return nil, zero, err
+	}
+
+	for _, src := range sources {
+		src.subscribe(d, func() { d.Reload() })
+	}
+
+	return d, d.Load(), nil
+}
+
+// subscribe registers fn to be called after each committed reload of d. For
+// a section of a group, fn is called after the reload of the group committed
+// all sections, once per key, even if several sections changed.
+func (d *Dynamic[T]) subscribe(key any, fn func()) {
+	d.onReload(func(_, _ T) {
+		if d.group != nil {
+			d.group.afterCommit(key, fn)
+			return
+		}
+
+		fn()
+	})
+}
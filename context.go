@@ -0,0 +1,40 @@
+package fxconfig
+
+import (
+	"context"
+
+	"schneider.vip/config"
+)
+
+// Freeze returns the latest config of dyn as a snapshot, e.g. once per
+// request: the snapshot is a value, which stays consistent for the whole
+// request even if the config is reloaded meanwhile. Calling Load repeatedly
+// in a handler might observe different configs instead. Freeze is Load, it
+// names the intent. Use NewContext to pass the snapshot down the request.
+func Freeze[T any](dyn config.Dynamic[T]) T {
+	return dyn.Load()
+}
+
+// contextKey is the key of the config of T in a context.Context, so configs
+// of different types don't collide.
+type contextKey[T any] struct{}
+
+// NewContext returns a copy of ctx which carries cfg, e.g. a snapshot by
+// Freeze in a middleware:
+//
+//	func Middleware(dyn config.Dynamic[ServiceConfig], next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			ctx := fxconfig.NewContext(r.Context(), fxconfig.Freeze(dyn))
+//			next.ServeHTTP(w, r.WithContext(ctx))
+//		})
+//	}
+func NewContext[T any](ctx context.Context, cfg T) context.Context {
+	return context.WithValue(ctx, contextKey[T]{}, cfg)
+}
+
+// FromContext returns the config of T carried by ctx, see NewContext. ok is
+// false if ctx carries none.
+func FromContext[T any](ctx context.Context) (cfg T, ok bool) {
+	cfg, ok = ctx.Value(contextKey[T]{}).(T)
+	return cfg, ok
+}
@@ -0,0 +1,123 @@
+package fxconfig
+
+import (
+	"reflect"
+	"sync"
+)
+
+// deepCopy returns a copy of v, which shares no maps, slices or pointers
+// with v. Unexported struct fields are copied shallow. A value of a type
+// without maps, slices, pointers or interfaces is returned as is, other
+// values are copied by reflection. v must not contain cyclic pointers, the
+// copy would not terminate.
+func deepCopy[T any](v T) T {
+	if !hasRefs(reflect.TypeFor[T]()) {
+		return v
+	}
+
+	return copyRefs(v)
+}
+
+// copyRefs copies v by reflection. It is separate from deepCopy, so v only
+// escapes to the heap if it is copied.
+func copyRefs[T any](v T) T {
+	return copyValue(reflect.ValueOf(&v).Elem()).Interface().(T)
+}
+
+// refTypes caches the results of hasRefs by type.
+var refTypes sync.Map
+
+// hasRefs reports whether values of t contain maps, slices, pointers or
+// interfaces in exported fields, which deepCopy copies.
+func hasRefs(t reflect.Type) bool {
+	if r, ok := refTypes.Load(t); ok {
+		return r.(bool)
+	}
+
+	r := typeHasRefs(t)
+	refTypes.Store(t, r)
+
+	return r
+}
+
+func typeHasRefs(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	case reflect.Array:
+		return typeHasRefs(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if f := t.Field(i); f.IsExported() && typeHasRefs(f.Type) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := range v.Len() {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+
+		for i := range v.NumField() {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+
+		return c
+	default:
+		return v
+	}
+}
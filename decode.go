@@ -0,0 +1,62 @@
+package fxconfig
+
+import (
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+	"schneider.vip/config"
+)
+
+// WithDecodeHook is an option to decode custom field types, e.g. an enum or
+// a duration type of its own, by mapstructure decode hooks. The loader of
+// the config package has no decode hooks, so with hooks fxconfig decodes the
+// config itself, on the initial load and on each reload. hooks run before
+// the default hooks of viper, which decode a time.Duration and a string
+// slice separated by ",". mapstructure provides hooks for common types,
+// e.g. mapstructure.StringToURLHookFunc or
+// mapstructure.TextUnmarshallerHookFunc for types implementing
+// encoding.TextUnmarshaler:
+//
+//	fxconfig.WithDecodeHook[ServiceConfig](mapstructure.StringToURLHookFunc())
+func WithDecodeHook[T any](hooks ...mapstructure.DecodeHookFunc) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.decodeHooks = append(o.decodeHooks, hooks...)
+	})
+}
+
+// WithStrictKeys is an option to reject keys of the config section which
+// match no field of T, e.g. the typo Ur1 instead of URL, which are ignored
+// otherwise. With it, fxconfig decodes the config itself and an unknown key
+// fails the initial load; a reload with an unknown key fails by the reload
+// failure policy, see WithReloadFailurePolicy. The error names the unknown
+// keys.
+//
+// Keys are matched like mapstructure decodes them: the fields of an embedded
+// struct are matched at the level of the embedding struct only with the tag
+// `mapstructure:",squash"`, otherwise the embedded struct is a key named
+// after its type. A map field with the tag `mapstructure:",remain"` collects
+// the unknown keys of its struct, so they are never rejected there.
+func WithStrictKeys[T any]() config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.strictKeys = true
+	})
+}
+
+// decoderOptions returns the viper decoder options of the decode hooks and
+// of WithStrictKeys.
+func (o *options[T]) decoderOptions() []viper.DecoderConfigOption {
+	var opts []viper.DecoderConfigOption
+
+	if len(o.decodeHooks) > 0 {
+		hooks := append(o.decodeHooks[:len(o.decodeHooks):len(o.decodeHooks)],
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		)
+		opts = append(opts, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(hooks...)))
+	}
+
+	if o.strictKeys {
+		opts = append(opts, func(c *mapstructure.DecoderConfig) { c.ErrorUnused = true })
+	}
+
+	return opts
+}
@@ -0,0 +1,58 @@
+package fxconfig
+
+import (
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// DescriptorGroup is the fx value group of the ConfigDescriptors.
+const DescriptorGroup = "fxconfig"
+
+// ConfigDescriptor describes a config provided by fxconfig, e.g. for an
+// admin endpoint which renders all loaded configs. Module, Static and the
+// sections of NewGroup put the descriptor of their config into the value
+// group "fxconfig", see DescriptorGroup:
+//
+//	type Params struct {
+//		fx.In
+//
+//		Configs []fxconfig.ConfigDescriptor `group:"fxconfig"`
+//	}
+type ConfigDescriptor struct {
+	// TypeName is the name of the config type, like in the logs.
+	TypeName string
+
+	// Name is the name set by WithName, otherwise TypeName.
+	Name string
+
+	// Snapshot returns the latest config, in which the fields tagged
+	// `secret:"true"` are redacted, see WithRedactTag. Structs are
+	// represented by maps of their config keys. It is safe for concurrent
+	// use.
+	Snapshot func() any
+}
+
+// NewDescriptor is a constructor of the ConfigDescriptor of the Dynamic
+// Config.
+func NewDescriptor[T any](dyn config.Dynamic[T]) ConfigDescriptor {
+	tag, name := defaultSecretTag, typeName[T]()
+	if d, ok := dyn.(*Dynamic[T]); ok {
+		tag, name = d.opts.redactTag(), d.opts.label()
+	}
+
+	return ConfigDescriptor{
+		TypeName: typeName[T](),
+		Name:     name,
+		Snapshot: func() any { return redact(dyn.Load(), tag) },
+	}
+}
+
+// WithDescriptor returns an fx.Option which puts the ConfigDescriptor of the
+// config of T into the value group "fxconfig". Module, Static and NewGroup
+// do so already, with New, NewE or NewManaged use:
+//
+//	fx.Provide(fxconfig.NewManaged(opts...)),
+//	fxconfig.WithDescriptor[ServiceConfig](),
+func WithDescriptor[T any]() fx.Option {
+	return fx.Provide(fx.Annotate(NewDescriptor[T], fx.ResultTags(`group:"`+DescriptorGroup+`"`)))
+}
@@ -0,0 +1,164 @@
+package fxconfig
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"schneider.vip/config"
+)
+
+// FieldChange is a field which changed by a reload. Path is the dotted path
+// of config keys to the field, e.g. "DB.Host", map entries are appended in
+// brackets, e.g. "Labels[team]". Old and New are represented like in the
+// logs of WithEventLogger: the values of fields tagged `secret:"true"`, or
+// by the tag of WithRedactTag, are "***".
+type FieldChange struct {
+	Path string
+	Old  any
+	New  any
+}
+
+// WithReloadDiff is an option to get the fields changed by a reload. fn is
+// called after each committed reload with the changed fields in the order of
+// their declaration, which makes reload audit logs actionable. Structs,
+// pointers to structs and maps are compared field-wise, other values such as
+// slices as a whole. Unexported fields are skipped, secret fields are
+// reported with their path but masked values. Calls are serialized and a
+// panic in fn is recovered and reported to the error sink, like one of an
+// OnReload callback.
+func WithReloadDiff[T any](fn func(changes []FieldChange)) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.diffs = append(o.diffs, fn)
+	})
+}
+
+// notifyDiff calls the reload diff functions with the changes from old to
+// new. It must be called with d.mu held.
+func (d *Dynamic[T]) notifyDiff(old, new T) {
+	if len(d.opts.diffs) == 0 {
+		return
+	}
+
+	changes := diff(reflect.ValueOf(old), reflect.ValueOf(new), "", d.opts.redactTag(), false)
+
+	for _, fn := range d.opts.diffs {
+		d.callDiff(fn, changes)
+	}
+}
+
+// callDiff calls fn, a panic of fn is reported to the error sink.
+func (d *Dynamic[T]) callDiff(fn func([]FieldChange), changes []FieldChange) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.callbackPanicked(r)
+		}
+	}()
+
+	fn(changes)
+}
+
+// diff returns the changes from old to new below path. The values of secret
+// changes, of fields tagged by tag, are masked.
+func diff(old, new reflect.Value, path, tag string, secret bool) []FieldChange {
+	if reflect.DeepEqual(valueOf(old), valueOf(new)) {
+		return nil
+	}
+
+	change := func() []FieldChange {
+		if secret {
+			return []FieldChange{{Path: path, Old: redacted, New: redacted}}
+		}
+
+		return []FieldChange{{Path: path, Old: redactValue(old, tag), New: redactValue(new, tag)}}
+	}
+
+	if secret || old.Kind() != new.Kind() {
+		return change()
+	}
+
+	switch old.Kind() {
+	case reflect.Pointer:
+		if old.IsNil() || new.IsNil() || old.Elem().Kind() != reflect.Struct {
+			return change()
+		}
+
+		return diff(old.Elem(), new.Elem(), path, tag, false)
+	case reflect.Struct:
+		if isLeaf(old.Type()) {
+			return change()
+		}
+
+		var changes []FieldChange
+
+		for i := range old.NumField() {
+			f := old.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			changes = append(changes, diff(old.Field(i), new.Field(i), joinPath(path, fieldName(f)), tag, isSecret(f, tag))...)
+		}
+
+		return changes
+	case reflect.Map:
+		if old.IsNil() || new.IsNil() {
+			return change()
+		}
+
+		var changes []FieldChange
+
+		for _, key := range sortedKeys(old, new) {
+			changes = append(changes, diff(old.MapIndex(key), new.MapIndex(key), fmt.Sprintf("%s[%v]", path, key.Interface()), tag, false)...)
+		}
+
+		return changes
+	default:
+		return change()
+	}
+}
+
+// valueOf returns the value of v, or nil if v is invalid, e.g. a missing map
+// entry.
+func valueOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	return v.Interface()
+}
+
+// joinPath appends name to the dotted path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// sortedKeys returns the keys of the maps a and b, sorted by their string
+// representation.
+func sortedKeys(a, b reflect.Value) []reflect.Value {
+	seen := make(map[string]reflect.Value)
+
+	for _, m := range []reflect.Value{a, b} {
+		for _, key := range m.MapKeys() {
+			seen[fmt.Sprint(key.Interface())] = key
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	keys := make([]reflect.Value, len(names))
+	for i, name := range names {
+		keys[i] = seen[name]
+	}
+
+	return keys
+}
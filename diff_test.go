@@ -0,0 +1,132 @@
+package fxconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+)
+
+type diffConfig struct {
+	URL      string
+	Password string `secret:"true"`
+	Labels   map[string]string
+	DB       struct {
+		Host string
+		Port int
+	}
+	internal string // skipped by the diff
+}
+
+func TestWithReloadDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	// write replaces the file atomically, so the watcher never reloads a
+	// partially written config.
+	write := func(data string) {
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+Service:
+  URL: first.example.com
+  Password: first
+  Labels:
+    team: core
+    tier: backend
+  DB:
+    Host: localhost
+    Port: 5432
+`)
+
+	diffs := make(chan []fxconfig.FieldChange, 10)
+
+	var dyn *fxconfig.Dynamic[diffConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[diffConfig](path),
+			config.WithSubSection[diffConfig]("Service"),
+			fxconfig.WithReloadDiff[diffConfig](func(changes []fxconfig.FieldChange) { diffs <- changes }),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	write(`
+Service:
+  URL: first.example.com
+  Password: second
+  Labels:
+    team: core
+    owner: ops
+  DB:
+    Host: db.example.com
+    Port: 5432
+`)
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []fxconfig.FieldChange{
+		{Path: "Password", Old: "***", New: "***"},
+		{Path: "Labels[owner]", Old: nil, New: "ops"},
+		{Path: "Labels[tier]", Old: "backend", New: nil},
+		{Path: "DB.Host", Old: "localhost", New: "db.example.com"},
+	}
+
+	if got := <-diffs; !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithReloadDiffStringer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("ServiceConfig:\n  URL: example.com\n  DB:\n    Host: db.example.com\n    Password: first-secret\n")
+
+	diffs := make(chan []fxconfig.FieldChange, 10)
+
+	var dyn *fxconfig.Dynamic[stringerConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[stringerConfig](path),
+			config.WithSubSection[stringerConfig]("ServiceConfig"),
+			fxconfig.WithReloadDiff[stringerConfig](func(changes []fxconfig.FieldChange) { diffs <- changes }),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	write("ServiceConfig:\n  URL: example.com\n  DB:\n    Host: db.example.com\n    Password: second-secret\n")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []fxconfig.FieldChange{{Path: "DB.Password", Old: "***", New: "***"}}
+
+	if got := <-diffs; !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %+v, want %+v", got, want)
+	}
+}
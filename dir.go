@@ -0,0 +1,120 @@
+package fxconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// NewFromDir returns an constructor like NewManaged, which merges the config
+// files in dir, e.g. the fragments of a conf.d directory or the files of a
+// Kubernetes ConfigMap volume. The files are merged in the lexical order of
+// their names like by NewMerged: later files override the keys of earlier
+// ones. Only files with an extension supported by viper, e.g. ".yaml",
+// ".json" or ".toml", are read; others and dotfiles are ignored. opts must
+// not set a source.
+//
+// The whole directory is watched: adding, editing or removing a file reloads
+// and merges the files again, so the keys of a removed file disappear. The
+// constructor fails if dir can't be read.
+func NewFromDir[T any](dir string, opts ...config.Option[T]) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[T], T, error) {
+	return func(lc fx.Lifecycle, sd fx.Shutdowner) (config.Dynamic[T], T, error) {
+		d, err := loadDir(dir, opts)
+		if err != nil {
+			var zero T
+			return nil, zero, err
+		}
+
+		d.manage(lc, sd)
+
+		return d, d.Load(), nil
+	}
+}
+
+// loadDir reads the config files in dir and loads their merged config.
+func loadDir[T any](dir string, opts []config.Option[T]) (*Dynamic[T], error) {
+	s := &sources{dir: filepath.Clean(dir)}
+	if err := s.scan(); err != nil {
+		return nil, fmt.Errorf("fxconfig: %w", err)
+	}
+
+	return loadSources(s, opts)
+}
+
+// scan reads the config files in the directory of s.
+func (s *sources) scan() error {
+	files, err := dirFiles(s.dir)
+	if err != nil {
+		return err
+	}
+
+	vipers := make([]*viper.Viper, 0, len(files))
+
+	for _, file := range files {
+		v := viper.NewWithOptions(viper.KeyDelimiter("_"))
+		v.SetConfigFile(file)
+
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read config file %s: %w", file, err)
+		}
+
+		vipers = append(vipers, v)
+	}
+
+	s.vipers = vipers
+
+	return nil
+}
+
+// dirFiles returns the config files in dir in lexical order.
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config dir: %w", err)
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		if !isConfigFile(entry.Name()) {
+			continue
+		}
+
+		// Follow symlinks, e.g. of a ConfigMap volume.
+		file := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// isConfigFile reports whether name is the name of a config file in a
+// config directory: not a dotfile and of a supported extension.
+func isConfigFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+
+	return slices.Contains(viper.SupportedExts, ext)
+}
+
+// dir returns the config directory to watch, if any.
+func (d *Dynamic[T]) dir() string {
+	if d.sources != nil {
+		return d.sources.dir
+	}
+
+	return ""
+}
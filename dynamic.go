@@ -0,0 +1,440 @@
+package fxconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// Dynamic is the config.Dynamic[T] provided by fxconfig. Unlike the loader of
+// the config package it owns the file watcher, so it can be stopped by Close.
+//
+// fxconfig passes its own viper instance to the loader, config.WithViperInstance
+// replaces it and disables the watcher.
+type Dynamic[T any] struct {
+	loader  config.Loader[T]
+	viper   *viper.Viper
+	section string
+	opts    *options[T]
+	group   *group            // shares the viper instance, if set
+	sources *sources          // merged into the viper instance, if set
+	derive  func() (T, error) // derives the config from another, if set
+	current atomic.Pointer[snapshot[T]]
+	health  atomic.Pointer[health]
+
+	mu       sync.Mutex // serializes reloads
+	onChange atomic.Pointer[func(error)]
+
+	commitMu  sync.Mutex
+	committed chan struct{} // closed by the next commit, see Ready
+
+	listenersMu sync.Mutex
+	listeners   []func(ev ReloadEvent[T])
+	observers   []ReloadObserver
+
+	shutdowner   fx.Shutdowner // for the Fatal reload failure policy, if set
+	shutdownOnce sync.Once
+
+	errsMu   sync.Mutex
+	errs     chan error // of the error sink, nil if none or closed
+	errsDone chan struct{}
+
+	switchMu  sync.Mutex      // serializes SwitchSource and Close
+	watchCtx  context.Context // of watch, nil if not watched
+	stop      chan struct{}
+	done      chan struct{}
+	watchErr  error // why the config is not watched, if so
+	closed    bool
+	closeOnce sync.Once
+}
+
+// Ensure Dynamic implements config.Dynamic
+var _ config.Dynamic[any] = (*Dynamic[any])(nil)
+
+// snapshot is a committed config together with its generation. Both are
+// swapped at once, so they are always read consistently.
+type snapshot[T any] struct {
+	value      T
+	generation uint64
+	raw        []byte // of the source, if read from a file
+}
+
+// load creates the loader of opts and parses the config initially.
+func load[T any](opts []config.Option[T]) (*Dynamic[T], error) {
+	return loadContext(context.Background(), opts)
+}
+
+// loadContext loads the config like load, failed loads are retried as set by
+// WithRetry until ctx is done.
+func loadContext[T any](ctx context.Context, opts []config.Option[T]) (*Dynamic[T], error) {
+	for attempt := 1; ; attempt++ {
+		d, o, err := loadOnce(opts)
+		if err == nil || attempt >= o.retryAttempts {
+			return d, err
+		}
+
+		delay := o.retryDelay(attempt)
+		slog.Warn("Failed to load config, retrying", "config", o.label(),
+			"attempt", attempt, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("fxconfig: initial load: %w", errors.Join(ctx.Err(), err))
+		}
+	}
+}
+
+// loadOnce creates the loader of opts and parses the config. The collected
+// options are returned even if that fails.
+func loadOnce[T any](opts []config.Option[T]) (*Dynamic[T], *options[T], error) {
+	v := viper.NewWithOptions(viper.KeyDelimiter("_"))
+	o := &options[T]{}
+
+	l, raw, err := newLoader(v, o, opts)
+	if err != nil {
+		return nil, o, err
+	}
+
+	d := &Dynamic[T]{
+		loader:  l,
+		viper:   v,
+		section: loaderSection(l),
+		opts:    o,
+	}
+
+	var value T
+	if o.decodes() {
+		if value, err = d.decode(); err != nil {
+			return nil, o, fmt.Errorf("fxconfig: failed to load config: %w", err)
+		}
+	} else {
+		value = l.Load()
+	}
+
+	if err := d.init(value, raw); err != nil {
+		return nil, o, err
+	}
+
+	return d, o, nil
+}
+
+// init applies the overrides to the initially parsed value, validates it and
+// stores it with the raw bytes of its source as the first generation. The
+// values of WithFlags are read here, once.
+func (d *Dynamic[T]) init(value T, raw []byte) error {
+	if d.opts.flags != nil {
+		d.opts.flagValues = d.opts.flags.set()
+	}
+
+	value, err := d.override(value)
+	if err == nil {
+		value, err = d.opts.postProcess(value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("fxconfig: failed to load config: %w", err)
+	}
+
+	if err := d.opts.validate(value); err != nil {
+		return fmt.Errorf("fxconfig: invalid config: %w", err)
+	}
+
+	d.current.Store(&snapshot[T]{value: value, generation: 1, raw: raw})
+	d.loaded()
+	d.opts.sinkRaw(raw)
+	if !d.opts.startupHook {
+		d.opts.logLoaded(1, value)
+	}
+
+	return nil
+}
+
+// Load returns the latest parsed configuration. Reloads commit a new
+// snapshot by an atomic pointer swap, so Load never observes a partially
+// updated config. The config is a deep copy of the snapshot: its maps,
+// slices and pointers can be modified by the caller without affecting the
+// snapshot or other callers. The copy walks the config by reflection and
+// allocates its maps, slices and pointers on every call; a config without
+// them is returned without copying. The config must not contain cyclic
+// pointers, which can't be copied.
+func (d *Dynamic[T]) Load() T {
+	return deepCopy(d.current.Load().value)
+}
+
+// Name returns the name of the config type, e.g. "main.ServiceConfig", or
+// the name set by WithName.
+func (d *Dynamic[T]) Name() string {
+	return d.opts.label()
+}
+
+// Generation returns the generation of the latest configuration. It starts
+// at 1 for the initial load and is incremented by every committed reload.
+func (d *Dynamic[T]) Generation() uint64 {
+	return d.current.Load().generation
+}
+
+// Raw returns the raw bytes of the config file, from which the latest
+// configuration was parsed. It is nil for configs not read from a single
+// file, e.g. from a reader. The bytes must not be modified.
+func (d *Dynamic[T]) Raw() []byte {
+	return d.current.Load().raw
+}
+
+// Snapshot returns the latest configuration together with its generation.
+// Unlike separate calls of Load and Generation, both belong to the same
+// reload. A consumer can compare the generation with Generation later to
+// detect a reload in between. Like by Load, the config is a deep copy.
+func (d *Dynamic[T]) Snapshot() (T, uint64) {
+	s := d.current.Load()
+	return deepCopy(s.value), s.generation
+}
+
+// SetOnChangeFunc sets a function which is called after every reload with
+// the error of the reload, if any.
+func (d *Dynamic[T]) SetOnChangeFunc(fn func(error)) {
+	d.onChange.Store(&fn)
+}
+
+// Reload reads the config source again and parses it. If that fails, the
+// config is invalid or rejected by a reload guard, the last config is kept
+// and the error is returned. A config equal to the current one is not
+// committed again: the generation stays and no reload callbacks are called.
+// A static config, see Static and WithStatic, is never reloaded.
+func (d *Dynamic[T]) Reload() error {
+	if d.opts.static {
+		return nil
+	}
+
+	if d.group != nil {
+		return d.group.reload(d)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.viper == nil && d.derive == nil {
+		return nil
+	}
+
+	return d.update(d.read())
+}
+
+// read reads the config source again and returns the raw bytes of a single
+// config file. A config read from a reader is kept.
+func (d *Dynamic[T]) read() ([]byte, error) {
+	if d.derive != nil {
+		return nil, nil
+	}
+
+	if d.sources != nil {
+		return nil, d.sources.read(d.viper)
+	}
+
+	if d.viper.ConfigFileUsed() != "" {
+		return readFile(d.viper)
+	}
+
+	return nil, nil
+}
+
+// files returns the config files to watch.
+func (d *Dynamic[T]) files() []string {
+	if d.sources != nil {
+		return d.sources.files()
+	}
+
+	if file := d.viper.ConfigFileUsed(); file != "" {
+		return []string{file}
+	}
+
+	return nil
+}
+
+// update parses the config read from the source and commits it with the raw
+// bytes of the source, unless err, the error of reading the source, is set.
+// It must be called with d.mu held.
+func (d *Dynamic[T]) update(raw []byte, err error) error {
+	var value T
+
+	if err == nil {
+		value, err = d.build()
+	}
+
+	if err != nil {
+		slog.Error("Failed to reload config", "config", d.opts.label(), "error", err)
+		d.reloadFailed(err)
+		d.opts.logReloadFailed(err)
+		d.reportError(err)
+		d.observe(func(obs ReloadObserver, config string) { obs.ReloadFailed(config, err) })
+		d.applyFailurePolicy(err)
+	} else {
+		d.store(value, raw)
+	}
+
+	d.notifyChange(err)
+
+	return err
+}
+
+// build parses the current settings of the source and applies the
+// overrides, the post processors, the validators and the reload guards.
+func (d *Dynamic[T]) build() (T, error) {
+	value, err := d.parse()
+
+	if err == nil {
+		value, err = d.override(value)
+	}
+
+	if err == nil {
+		value, err = d.opts.postProcess(value)
+	}
+
+	if err == nil {
+		if verr := d.opts.validate(value); verr != nil {
+			err = fmt.Errorf("invalid config: %w", verr)
+		}
+	}
+
+	if err == nil {
+		if gerr := d.opts.guard(value); gerr != nil {
+			err = fmt.Errorf("reload rejected: %w", gerr)
+		}
+	}
+
+	return value, err
+}
+
+// store commits value with the raw bytes of its source as the next
+// generation, unless it equals the current config, and calls the reload
+// callbacks. It must be called with d.mu held.
+func (d *Dynamic[T]) store(value T, raw []byte) {
+	cur := d.current.Load()
+	if reflect.DeepEqual(cur.value, value) {
+		d.loaded()
+		return
+	}
+
+	next := &snapshot[T]{value: value, generation: cur.generation + 1, raw: raw}
+	d.current.Store(next)
+	d.signalCommit()
+	d.loaded()
+	d.opts.sinkRaw(raw)
+	slog.Info("Config reloaded successfully", "config", d.opts.label())
+	d.opts.logReloaded(next.generation, value)
+	d.observe(func(obs ReloadObserver, config string) { obs.Reloaded(config, next.generation) })
+	d.notify(ReloadEvent[T]{
+		Old:        cur.value,
+		New:        value,
+		Generation: next.generation,
+		Time:       d.state().loaded,
+	})
+	d.notifyDiff(cur.value, value)
+	d.opts.signalReload(next.generation)
+}
+
+// notifyChange calls the func of SetOnChangeFunc, if any, with the error of a
+// reload. A panic of the func is reported to the error sink.
+func (d *Dynamic[T]) notifyChange(err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.callbackPanicked(r)
+		}
+	}()
+
+	if fn := d.onChange.Load(); fn != nil && *fn != nil {
+		(*fn)(err)
+	}
+}
+
+// parse parses the current settings of the viper instance.
+func (d *Dynamic[T]) parse() (T, error) {
+	if d.derive != nil {
+		return d.derive()
+	}
+
+	if d.loader == nil || d.sources != nil || d.opts.decodes() {
+		return d.decode()
+	}
+
+	if err := d.loader.Parse(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return d.loader.Load(), nil
+}
+
+// override applies the overrides of the options, WithEnvPrefix and then
+// WithFlags, to the parsed cfg.
+func (d *Dynamic[T]) override(cfg T) (T, error) {
+	var err error
+
+	if d.opts.envPrefix != nil {
+		if cfg, err = applyEnv(cfg, *d.opts.envPrefix, d.section); err != nil {
+			return cfg, err
+		}
+	}
+
+	if d.opts.flags != nil {
+		return applyFlags(cfg, d.opts.flags.prefix, d.opts.flagValues)
+	}
+
+	return cfg, nil
+}
+
+// decode decodes the sub section of the viper instance like the loader of
+// the config package, on top of the default config. A missing sub section
+// is the default config with WithDefault or Optional.
+func (d *Dynamic[T]) decode() (T, error) {
+	var cfg T
+	if d.opts.def != nil {
+		cfg = deepCopy(*d.opts.def)
+	}
+
+	v := d.viper
+	if d.section != "" {
+		if v = v.Sub(d.section); v == nil {
+			switch {
+			case d.viper.IsSet(d.section):
+				return cfg, fmt.Errorf("section is not a map in config: %q", d.section)
+			case d.opts.def != nil || d.opts.optional:
+				return cfg, nil
+			}
+
+			return cfg, fmt.Errorf("section not found in config: %q", d.section)
+		}
+	}
+
+	if err := v.Unmarshal(&cfg, d.opts.decoderOptions()...); err != nil {
+		return cfg, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Close stops the file watcher and the error sink. The last loaded config
+// stays available by Load.
+func (d *Dynamic[T]) Close() error {
+	d.closeOnce.Do(func() {
+		d.switchMu.Lock()
+		d.closed = true
+		d.stopWatcher()
+		d.switchMu.Unlock()
+
+		d.stopErrorSink()
+	})
+
+	return nil
+}
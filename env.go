@@ -0,0 +1,203 @@
+package fxconfig
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"schneider.vip/config"
+)
+
+// WithEnvPrefix is an option to override fields of the config by environment
+// variables. The name of a variable is prefix, the sub section and the
+// mapstructure names of the fields, joined by "_" and upper-cased, e.g.
+// APP_SERVICECONFIG_URL for the field URL of the sub section ServiceConfig
+// with prefix "APP". Nested structs add their field name, e.g.
+// APP_SERVICECONFIG_TLS_CERTFILE.
+//
+// The variables are applied after each load and reload, so the environment
+// overrides the file, which overrides defaults. Supported are strings, bools,
+// numbers, time.Duration and string slices, separated by ",". A bool is
+// parsed by strconv.ParseBool, so "1", "t" and "TRUE" are true as well. A
+// variable set to the empty string clears a string or slice field and is
+// ignored for other kinds, as it has no zero value to parse. Tags like
+// ",omitempty" only affect the name, not whether an override applies. A
+// value which can't be parsed fails the load or reload.
+func WithEnvPrefix[T any](prefix string) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.envPrefix = &prefix
+	})
+}
+
+// applyEnv overrides the fields of cfg by the environment variables named
+// after prefix and section.
+func applyEnv[T any](cfg T, prefix, section string) (T, error) {
+	var parts []string
+	for _, part := range []string{prefix, section} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	v := reflect.ValueOf(&cfg).Elem()
+	if err := applyOverrides(v, strings.ToUpper(strings.Join(parts, "_")), envSource); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// overrideSource is a source of overrides of config fields, e.g. the
+// environment.
+type overrideSource struct {
+	// key returns the key of field below the key of its parent.
+	key func(parent, field string) string
+
+	// lookup returns the value of key, if set.
+	lookup func(key string) (string, bool)
+
+	// describe describes key in errors.
+	describe func(key string) string
+}
+
+// envSource overrides fields by environment variables.
+var envSource = overrideSource{
+	key: func(parent, field string) string {
+		if parent == "" {
+			return strings.ToUpper(field)
+		}
+
+		return parent + "_" + strings.ToUpper(field)
+	},
+	lookup:   os.LookupEnv,
+	describe: func(key string) string { return "environment variable " + key },
+}
+
+// applyOverrides overrides v by the value of key in src or, for structs, its
+// fields by the values of the keys below key. It reports an error of a value
+// which can't be parsed.
+func applyOverrides(v reflect.Value, key string, src overrideSource) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() || f.Tag.Get("mapstructure") == "-" {
+				continue
+			}
+
+			if err := applyOverrides(v.Field(i), src.key(key, fieldName(f)), src); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+
+		// Allocate a nil struct only if a value applies to it.
+		elem := reflect.New(v.Type().Elem())
+		if !v.IsNil() {
+			elem.Elem().Set(v.Elem())
+		}
+
+		before := elem.Elem().Interface()
+		if err := applyOverrides(elem.Elem(), key, src); err != nil {
+			return err
+		}
+
+		if !v.IsNil() || !reflect.DeepEqual(before, elem.Elem().Interface()) {
+			v.Set(elem)
+		}
+
+		return nil
+	}
+
+	value, ok := src.lookup(key)
+	if !ok || key == "" {
+		return nil
+	}
+
+	if err := setValue(v, value); err != nil {
+		return fmt.Errorf("%s: %w", src.describe(key), err)
+	}
+
+	return nil
+}
+
+// setValue parses env, the value of an override, into v.
+func setValue(v reflect.Value, env string) error {
+	if env == "" {
+		switch v.Kind() {
+		case reflect.String, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+
+		return nil
+	}
+
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(env)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(env, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(env, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(env, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+
+		items := strings.Split(env, ",")
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			s.Index(i).SetString(strings.TrimSpace(item))
+		}
+
+		v.Set(s)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
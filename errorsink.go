@@ -0,0 +1,91 @@
+package fxconfig
+
+import (
+	"fmt"
+	"log/slog"
+
+	"schneider.vip/config"
+)
+
+// errorSinkSize is the number of background errors buffered for the error
+// sink. Further errors are dropped until the sink caught up.
+const errorSinkSize = 16
+
+// WithErrorSink is an option to receive background errors: failures of the
+// file watcher and failed reloads. These are distinct from an error of the
+// initial load, which fails the constructor instead. fn is called from a
+// dedicated goroutine, so a slow fn never blocks the watcher; errors which
+// arrive while the buffer is full are dropped and logged. The goroutine
+// stops when the Dynamic Config is closed, e.g. on fx shutdown with
+// NewManaged or Module.
+func WithErrorSink[T any](fn func(error)) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.errorSink = fn
+	})
+}
+
+// startErrorSink starts the goroutine calling the error sink, if any.
+func (d *Dynamic[T]) startErrorSink() {
+	if d.opts.errorSink == nil {
+		return
+	}
+
+	errs, done := make(chan error, errorSinkSize), make(chan struct{})
+
+	d.errsMu.Lock()
+	d.errs, d.errsDone = errs, done
+	d.errsMu.Unlock()
+
+	go func() {
+		defer close(done)
+
+		for err := range errs {
+			callErrorSink(d.opts.errorSink, err)
+		}
+	}()
+}
+
+// reportError passes a background error to the error sink without blocking.
+// With WithName the error is prefixed by the name.
+func (d *Dynamic[T]) reportError(err error) {
+	d.errsMu.Lock()
+	defer d.errsMu.Unlock()
+
+	if d.errs == nil {
+		return
+	}
+
+	if d.opts.name != "" {
+		err = fmt.Errorf("%s: %w", d.opts.name, err)
+	}
+
+	select {
+	case d.errs <- err:
+	default:
+		slog.Warn("Config error sink is full, dropping error", "config", d.opts.label(), "error", err)
+	}
+}
+
+// stopErrorSink stops the error sink goroutine after it delivered the
+// buffered errors.
+func (d *Dynamic[T]) stopErrorSink() {
+	d.errsMu.Lock()
+	errs, done := d.errs, d.errsDone
+	d.errs = nil
+	d.errsMu.Unlock()
+
+	if errs != nil {
+		close(errs)
+		<-done
+	}
+}
+
+func callErrorSink(fn func(error), err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Config error sink panicked", "panic", r)
+		}
+	}()
+
+	fn(err)
+}
@@ -0,0 +1,135 @@
+package fxconfig
+
+import (
+	"fmt"
+	"log/slog"
+
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+	"schneider.vip/config"
+)
+
+// WithEventLogger is an option to log reloads to the logger used by fx, as set
+// by fx.WithLogger. A successful reload is logged with the config type, the
+// generation and the config, in which fields tagged `secret:"true"` are
+// redacted, see WithRedactTag. A failed reload is logged with its error.
+//
+// fx events can't be extended, so the messages are written to the logger
+// behind the fxevent.Logger: zap for fxevent.ZapLogger, slog for
+// fxevent.SlogLogger and the writer of fxevent.ConsoleLogger. Other loggers
+// fall back to the default slog logger, fxevent.NopLogger logs nothing.
+func WithEventLogger[T any](logger fxevent.Logger) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.eventLogger = logger
+	})
+}
+
+// WithStartupLog is an option to log the effective config once, when it is
+// loaded initially, to the logger used by fx like WithEventLogger. The config
+// is logged after the overrides of WithEnvPrefix and WithFlags applied, with
+// its type and the fields tagged `secret:"true"` redacted, see
+// WithRedactTag. A failed initial load is not logged, it fails the
+// constructor. With WithStartupHook, the config is logged by its OnStart hook
+// instead.
+func WithStartupLog[T any](logger fxevent.Logger) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.startupLogger = logger
+	})
+}
+
+// logLoaded logs the initially loaded config of generation to the startup
+// logger.
+func (o *options[T]) logLoaded(generation uint64, cfg T) {
+	logConfig[T](o.startupLogger, o.name, "config loaded", "CONFIG LOADED", generation, redact(cfg, o.redactTag()))
+}
+
+// logReloaded logs a successful reload to the event logger.
+func (o *options[T]) logReloaded(generation uint64, cfg T) {
+	logConfig[T](o.eventLogger, o.name, "config reloaded", "CONFIG RELOADED", generation, redact(cfg, o.redactTag()))
+}
+
+// logConfig logs the redacted config of T, named name if set, and its
+// generation with msg, or event for the fxevent.ConsoleLogger, to logger.
+func logConfig[T any](logger fxevent.Logger, name, msg, event string, generation uint64, cfg any) {
+	typ := typeName[T]()
+
+	switch logger := logger.(type) {
+	case nil:
+	case *fxevent.ZapLogger:
+		logger.Logger.Info(msg, append(zapName(name),
+			zap.String("type", typ),
+			zap.Uint64("generation", generation),
+			zap.Any("config", cfg),
+		)...)
+	case *fxevent.ConsoleLogger:
+		fmt.Fprintf(logger.W, "[Fx] %s\t%s%s generation=%d config=%v\n", event, typ, consoleName(name), generation, cfg)
+	default:
+		if logger == fxevent.NopLogger {
+			return
+		}
+
+		slogger(logger).Info(msg, append(slogName(name),
+			slog.String("type", typ),
+			slog.Uint64("generation", generation),
+			slog.Any("config", cfg),
+		)...)
+	}
+}
+
+// logReloadFailed logs a failed reload to the event logger.
+func (o *options[T]) logReloadFailed(err error) {
+	const msg = "config reload failed"
+
+	typ := typeName[T]()
+
+	switch logger := o.eventLogger.(type) {
+	case nil:
+	case *fxevent.ZapLogger:
+		logger.Logger.Error(msg, append(zapName(o.name), zap.String("type", typ), zap.Error(err))...)
+	case *fxevent.ConsoleLogger:
+		fmt.Fprintf(logger.W, "[Fx] CONFIG RELOAD FAILED\t%s%s error=%v\n", typ, consoleName(o.name), err)
+	default:
+		if logger == fxevent.NopLogger {
+			return
+		}
+
+		slogger(logger).Error(msg, append(slogName(o.name), slog.String("type", typ), slog.Any("error", err))...)
+	}
+}
+
+// zapName returns the zap field of name, if set.
+func zapName(name string) []zap.Field {
+	if name == "" {
+		return nil
+	}
+
+	return []zap.Field{zap.String("name", name)}
+}
+
+// slogName returns the slog attribute of name, if set.
+func slogName(name string) []any {
+	if name == "" {
+		return nil
+	}
+
+	return []any{slog.String("name", name)}
+}
+
+// consoleName returns name formatted for the fxevent.ConsoleLogger, if set.
+func consoleName(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" name=%q", name)
+}
+
+// slogger returns the slog logger of an fxevent.SlogLogger, otherwise the
+// default logger.
+func slogger(logger fxevent.Logger) *slog.Logger {
+	if logger, ok := logger.(*fxevent.SlogLogger); ok {
+		return logger.Logger
+	}
+
+	return slog.Default()
+}
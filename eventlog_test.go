@@ -0,0 +1,265 @@
+package fxconfig_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/fx/fxtest"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+type secretConfig struct {
+	URL      string
+	Password string `secret:"true"`
+}
+
+func TestWithEventLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("ServiceConfig:\n  URL: first.example.com\n  Password: first-secret\n")
+
+	var out syncBuffer
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[secretConfig](path),
+			config.WithSubSection[secretConfig]("ServiceConfig"),
+			fxconfig.WithEventLogger[secretConfig](&fxevent.ConsoleLogger{W: &out}),
+		),
+		fx.Invoke(func(secretConfig) {}),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	write("ServiceConfig:\n  URL: second.example.com\n  Password: second-secret\n")
+	eventually(t, func() bool { return strings.Contains(out.String(), "CONFIG RELOADED") })
+
+	log := out.String()
+	for _, want := range []string{"fxconfig_test.secretConfig", "generation=2", "second.example.com", "Password:***"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log %q does not contain %q", log, want)
+		}
+	}
+
+	if strings.Contains(log, "second-secret") {
+		t.Errorf("log %q contains the secret", log)
+	}
+}
+
+type startupConfig struct {
+	URL      string
+	Token    string `sensitive:"true"`
+	Backends []struct {
+		Host string
+		Key  string `sensitive:"true"`
+	}
+}
+
+func TestWithStartupLog(t *testing.T) {
+	t.Setenv("APP_SERVICECONFIG_URL", "env.example.com")
+
+	const data = `
+ServiceConfig:
+  URL: file.example.com
+  Token: token-secret
+  Backends:
+  - Host: a.example.com
+    Key: key-secret
+`
+
+	var out syncBuffer
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigReader[startupConfig](strings.NewReader(data), "yaml"),
+			config.WithSubSection[startupConfig]("ServiceConfig"),
+			fxconfig.WithEnvPrefix[startupConfig]("APP"),
+			fxconfig.WithRedactTag[startupConfig]("sensitive"),
+			fxconfig.WithStartupLog[startupConfig](&fxevent.ConsoleLogger{W: &out}),
+		),
+		fx.Invoke(func(startupConfig) {}),
+	)
+	app.RequireStart()
+	app.RequireStop()
+
+	log := out.String()
+	if n := strings.Count(log, "CONFIG LOADED"); n != 1 {
+		t.Errorf("logged %d times, want once: %q", n, log)
+	}
+
+	for _, want := range []string{"fxconfig_test.startupConfig", "generation=1", "env.example.com", "a.example.com", "Token:***", "Key:***"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log %q does not contain %q", log, want)
+		}
+	}
+
+	for _, secret := range []string{"token-secret", "key-secret", "file.example.com"} {
+		if strings.Contains(log, secret) {
+			t.Errorf("log %q contains %q", log, secret)
+		}
+	}
+}
+
+type stringerDB struct {
+	Host     string
+	Password string `secret:"true"`
+}
+
+func (db stringerDB) String() string { return db.Host + ":" + db.Password }
+
+type stringerConfig struct {
+	URL   string
+	Token string `secret:"true"`
+	DB    stringerDB
+}
+
+func (c stringerConfig) String() string { return c.URL + " " + c.Token }
+
+func TestWithStartupLogStringer(t *testing.T) {
+	const data = `
+ServiceConfig:
+  URL: example.com
+  Token: token-secret
+  DB:
+    Host: db.example.com
+    Password: db-secret
+`
+
+	var out syncBuffer
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigReader[stringerConfig](strings.NewReader(data), "yaml"),
+			config.WithSubSection[stringerConfig]("ServiceConfig"),
+			fxconfig.WithStartupLog[stringerConfig](&fxevent.ConsoleLogger{W: &out}),
+		),
+		fx.Invoke(func(stringerConfig) {}),
+	)
+	app.RequireStart()
+	app.RequireStop()
+
+	log := out.String()
+	for _, want := range []string{"example.com", "db.example.com", "Token:***", "Password:***"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log %q does not contain %q", log, want)
+		}
+	}
+
+	for _, secret := range []string{"token-secret", "db-secret"} {
+		if strings.Contains(log, secret) {
+			t.Errorf("log %q contains %q", log, secret)
+		}
+	}
+}
+
+// orderWriter records a write as event "config" in order.
+type orderWriter struct{ order *[]string }
+
+func (w orderWriter) Write(p []byte) (int, error) {
+	*w.order = append(*w.order, "config")
+	return len(p), nil
+}
+
+func TestWithStartupHook(t *testing.T) {
+	const data = "ServiceConfig:\n  URL: example.com\n"
+
+	t.Run("ordered", func(t *testing.T) {
+		var order []string
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigReader[testConfig](strings.NewReader(data), "yaml"),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithStartupLog[testConfig](&fxevent.ConsoleLogger{W: orderWriter{&order}}),
+				fxconfig.WithStartupHook[testConfig](),
+			),
+			fx.Invoke(func(lc fx.Lifecycle, _ testConfig) {
+				lc.Append(fx.StartHook(func() { order = append(order, "server") }))
+			}),
+		)
+
+		if len(order) != 0 {
+			t.Fatalf("logged at construction: %v", order)
+		}
+
+		app.RequireStart()
+		app.RequireStop()
+
+		if strings.Join(order, ",") != "config,server" {
+			t.Fatalf("order = %v, want config before server", order)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var invalid atomic.Bool
+
+		app := fx.New(
+			fx.NopLogger,
+			fxconfig.Module(
+				config.WithConfigReader[testConfig](strings.NewReader(data), "yaml"),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithValidator(func(testConfig) error {
+					if invalid.Load() {
+						return errors.New("invalid")
+					}
+
+					return nil
+				}),
+				fxconfig.WithStartupHook[testConfig](),
+			),
+			fx.Invoke(func(testConfig) { invalid.Store(true) }),
+		)
+
+		err := app.Start(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "invalid config at startup") {
+			t.Fatalf("Start() = %v, want an invalid config", err)
+		}
+	})
+
+	t.Run("unmanaged", func(t *testing.T) {
+		opts := []config.Option[testConfig]{
+			config.WithConfigReader[testConfig](strings.NewReader(data), "yaml"),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithStartupHook[testConfig](),
+		}
+
+		if _, _, err := fxconfig.NewE(opts...)(); err == nil || !strings.Contains(err.Error(), "WithStartupHook") {
+			t.Fatalf("NewE() = %v, want an error naming WithStartupHook", err)
+		}
+	})
+}
@@ -1,8 +1,9 @@
 package fxconfig_test
 
 import (
+	"context"
 	"fmt"
-	"time"
+	"strings"
 
 	"schneider.vip/config"
 	"schneider.vip/fxconfig"
@@ -10,6 +11,12 @@ import (
 	"go.uber.org/fx"
 )
 
+const exampleConfig = `
+ServiceConfig:
+  URL: example.com
+  True: true
+`
+
 // ConfigSection represents a configuration section.
 type ConfigSection struct {
 	URL  string
@@ -18,20 +25,21 @@ type ConfigSection struct {
 
 // NewService is a constructor that uses the dynamic configuration.
 func NewService(loader config.Dynamic[ConfigSection]) {
-	for {
-		cfg := loader.Load()
-		fmt.Printf("Service Config: URL=%s, True=%v\n", cfg.URL, cfg.True)
-		time.Sleep(1 * time.Second)
-	}
+	cfg := loader.Load()
+	fmt.Printf("Service Config: URL=%s, True=%v\n", cfg.URL, cfg.True)
 }
 
 // Example_fxconfig demonstrates how to use fxconfig with fx to load and inject configuration sections.
 func Example_fxconfig() {
 	// Create a new fx App with fxconfig.
 	app := fx.New(
+		fx.NopLogger,
 		fx.Provide(
 			// Provide a dynamic configuration loader for the ConfigSection.
-			fxconfig.New(config.WithSubSection[ConfigSection]("ServiceConfig")),
+			fxconfig.New(
+				config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("ServiceConfig"),
+			),
 		),
 		fx.Invoke(
 			// Invoke the NewService function with the loaded configuration.
@@ -40,8 +48,250 @@ func Example_fxconfig() {
 	)
 
 	// Run the application.
-	app.Run()
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// Service Config: URL=example.com, True=true
+}
+
+// ExampleNewE shows that a config which can't be loaded fails fx.New.
+func ExampleNewE() {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			fxconfig.NewE(
+				config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("MissingSection"),
+			),
+		),
+		fx.Invoke(NewService),
+	)
+
+	fmt.Println("failed:", app.Err() != nil)
+
+	// Output:
+	// failed: true
+}
+
+// ExampleModule shows how to provide a config section with a module.
+func ExampleModule() {
+	app := fx.New(
+		fx.NopLogger,
+		fxconfig.Module(
+			config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+			config.WithSubSection[ConfigSection]("ServiceConfig"),
+		),
+		fx.Invoke(NewService),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
 
 	// Output:
 	// Service Config: URL=example.com, True=true
 }
+
+const namedConfig = `
+PrimaryService:
+  URL: primary.example.com
+SecondaryService:
+  URL: secondary.example.com
+`
+
+// ExampleNewNamed shows how to provide two sections of the same type.
+func ExampleNewNamed() {
+	type services struct {
+		fx.In
+
+		Primary   ConfigSection                 `name:"primary"`
+		Secondary config.Dynamic[ConfigSection] `name:"secondary"`
+	}
+
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			fxconfig.NewNamed("primary",
+				config.WithConfigReader[ConfigSection](strings.NewReader(namedConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("PrimaryService"),
+			),
+			fxconfig.NewNamed("secondary",
+				config.WithConfigReader[ConfigSection](strings.NewReader(namedConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("SecondaryService"),
+			),
+		),
+		fx.Invoke(func(s services) {
+			fmt.Println("Primary:", s.Primary.URL)
+			fmt.Println("Secondary:", s.Secondary.Load().URL)
+		}),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// Primary: primary.example.com
+	// Secondary: secondary.example.com
+}
+
+// ExampleNewValue shows how to provide only the parsed config.
+func ExampleNewValue() {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			fxconfig.NewValue(
+				config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("ServiceConfig"),
+			),
+		),
+		fx.Invoke(func(cfg ConfigSection) {
+			fmt.Println("URL:", cfg.URL)
+		}),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// URL: example.com
+}
+
+type stubLoader struct{ cfg ConfigSection }
+
+func (s stubLoader) Load() ConfigSection { return s.cfg }
+
+// ExampleLoader shows how to replace the config of a consumer by a stub.
+func ExampleLoader() {
+	app := fx.New(
+		fx.NopLogger,
+		fxconfig.Module(
+			config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+			config.WithSubSection[ConfigSection]("ServiceConfig"),
+		),
+		fx.Decorate(func(fxconfig.Loader[ConfigSection]) fxconfig.Loader[ConfigSection] {
+			return stubLoader{ConfigSection{URL: "stub.example.com"}}
+		}),
+		fx.Invoke(func(loader fxconfig.Loader[ConfigSection]) {
+			fmt.Println("URL:", loader.Load().URL)
+		}),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// URL: stub.example.com
+}
+
+// URLProvider is a narrow interface a consumer depends on instead of
+// ConfigSection.
+type URLProvider interface {
+	ServiceURL() string
+}
+
+func (c ConfigSection) ServiceURL() string { return c.URL }
+
+// ExampleNewAs shows how to provide the config as an interface.
+func ExampleNewAs() {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			fxconfig.NewAs[ConfigSection, URLProvider](
+				config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("ServiceConfig"),
+			),
+		),
+		fx.Invoke(func(p URLProvider) {
+			fmt.Println("URL:", p.ServiceURL())
+		}),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// URL: example.com
+}
+
+// ExampleNewAnnotated shows how to collect configs in a value group.
+func ExampleNewAnnotated() {
+	type params struct {
+		fx.In
+
+		Configs []ConfigSection `group:"configs"`
+	}
+
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			fxconfig.NewAnnotated(
+				[]fx.Annotation{fxconfig.Tag(`group:"configs"`)},
+				config.WithConfigReader[ConfigSection](strings.NewReader(namedConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("PrimaryService"),
+			),
+			fxconfig.NewAnnotated(
+				[]fx.Annotation{fxconfig.Tag(`group:"configs"`)},
+				config.WithConfigReader[ConfigSection](strings.NewReader(namedConfig), "yaml"),
+				config.WithSubSection[ConfigSection]("SecondaryService"),
+			),
+		),
+		fx.Invoke(func(p params) {
+			fmt.Println("configs:", len(p.Configs))
+		}),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// configs: 2
+}
+
+// ExampleOverride shows how to replace the config of a real module, e.g. in
+// an integration test with fxtest.New(t, realModule, fxconfig.Override(...)).
+func ExampleOverride() {
+	realModule := fxconfig.Module(
+		config.WithConfigFile[ConfigSection]("/etc/service/config.yml"),
+		config.WithSubSection[ConfigSection]("ServiceConfig"),
+	)
+
+	app := fx.New(
+		fx.NopLogger,
+		realModule,
+		fxconfig.Override(ConfigSection{URL: "test.example.com"}),
+		fx.Invoke(NewService),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// Service Config: URL=test.example.com, True=false
+}
+
+// ExampleFreeze shows how to use one snapshot of the config per request.
+func ExampleFreeze() {
+	handle := func(ctx context.Context) {
+		cfg, _ := fxconfig.FromContext[ConfigSection](ctx)
+		fmt.Println("URL:", cfg.URL)
+	}
+
+	app := fx.New(
+		fx.NopLogger,
+		fxconfig.Module(
+			config.WithConfigReader[ConfigSection](strings.NewReader(exampleConfig), "yaml"),
+			config.WithSubSection[ConfigSection]("ServiceConfig"),
+		),
+		fx.Invoke(func(dyn config.Dynamic[ConfigSection]) {
+			// A middleware freezes the config once per request.
+			ctx := fxconfig.NewContext(context.Background(), fxconfig.Freeze(dyn))
+			handle(ctx)
+		}),
+	)
+
+	app.Start(context.Background())
+	app.Stop(context.Background())
+
+	// Output:
+	// URL: example.com
+}
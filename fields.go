@@ -0,0 +1,22 @@
+package fxconfig
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldName returns the config key of a struct field, which is the name of
+// its mapstructure tag or else the field name.
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if name == "" {
+		return f.Name
+	}
+
+	return name
+}
+
+// typeName returns the name of T used in logs.
+func typeName[T any]() string {
+	return reflect.TypeFor[T]().String()
+}
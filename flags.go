@@ -0,0 +1,152 @@
+package fxconfig
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"time"
+
+	"schneider.vip/config"
+)
+
+// WithFlags is an option to override fields of the config by command line
+// flags. A flag is registered at fs for each field when WithFlags is called,
+// so it must be called before fs is parsed. The name of a flag is prefix and
+// the mapstructure names of the fields, lower-cased and joined by ".", e.g.
+// -serviceconfig.url for the field URL with prefix "serviceconfig". Nested
+// structs add their field name, e.g. -serviceconfig.tls.certfile. The types
+// supported by WithEnvPrefix are supported, fields of other types get no
+// flag. Bool flags may omit the value, like -serviceconfig.debug.
+//
+// The flags which were set are read once at the initial load, as they are
+// process arguments, and override the config of each load and reload after
+// WithEnvPrefix. So the precedence is flags, environment, file and defaults.
+// A value which can't be parsed fails the initial load.
+func WithFlags[T any](fs *flag.FlagSet, prefix string) config.Option[T] {
+	flags := &flagSet{
+		prefix: strings.ToLower(prefix),
+		values: make(map[string]*flagValue),
+	}
+	registerFlags(fs, reflect.TypeFor[T](), flags.prefix, flags.values)
+
+	return newOption(func(o *options[T]) {
+		o.flags = flags
+	})
+}
+
+// flagSet holds the flags registered by WithFlags.
+type flagSet struct {
+	prefix string
+	values map[string]*flagValue
+}
+
+// flagValue is the flag.Value of a config field.
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+// flagSource overrides fields by the flag values.
+func flagSource(values map[string]string) overrideSource {
+	return overrideSource{
+		key: flagKey,
+		lookup: func(key string) (string, bool) {
+			value, ok := values[key]
+			return value, ok
+		},
+		describe: func(key string) string { return "flag -" + key },
+	}
+}
+
+// flagKey returns the flag name of field below parent.
+func flagKey(parent, field string) string {
+	if parent == "" {
+		return strings.ToLower(field)
+	}
+
+	return parent + "." + strings.ToLower(field)
+}
+
+// registerFlags registers a flag at fs for each field of t of a supported
+// type, named key below the struct, and adds it to flags.
+func registerFlags(fs *flag.FlagSet, t reflect.Type, key string, flags map[string]*flagValue) {
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() || f.Tag.Get("mapstructure") == "-" {
+				continue
+			}
+
+			registerFlags(fs, f.Type, flagKey(key, fieldName(f)), flags)
+		}
+
+		return
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			registerFlags(fs, t.Elem(), key, flags)
+		}
+
+		return
+	}
+
+	if key == "" || !flagSupported(t) {
+		return
+	}
+
+	value := &flagValue{isBool: t.Kind() == reflect.Bool}
+	fs.Var(value, key, "overrides "+key+" of the config")
+	flags[key] = value
+}
+
+// flagSupported reports whether a field of type t can be set by a flag.
+func flagSupported(t reflect.Type) bool {
+	if t == reflect.TypeFor[time.Duration]() {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+
+	return false
+}
+
+// set returns the values of the flags which were set.
+func (f *flagSet) set() map[string]string {
+	values := make(map[string]string)
+
+	for key, value := range f.values {
+		if value.set {
+			values[key] = value.value
+		}
+	}
+
+	return values
+}
+
+// applyFlags overrides the fields of cfg by the flag values named after
+// prefix.
+func applyFlags[T any](cfg T, prefix string, values map[string]string) (T, error) {
+	if err := applyOverrides(reflect.ValueOf(&cfg).Elem(), prefix, flagSource(values)); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
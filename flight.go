@@ -0,0 +1,60 @@
+package fxconfig
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"schneider.vip/config"
+)
+
+// flights shares the initial load between concurrent calls of a constructor.
+// A call arriving while a load runs waits for it and gets its result, a
+// later call loads again. So no result, in particular no error, is kept
+// once all waiting calls got it.
+type flights[T any] struct {
+	mu      sync.Mutex
+	current *flight[T]
+}
+
+// flight is a running initial load.
+type flight[T any] struct {
+	done chan struct{}
+	d    *Dynamic[T]
+	err  error
+}
+
+// load loads the config of opts and starts watching it, or waits for the
+// load already running.
+func (f *flights[T]) load(opts []config.Option[T]) (*Dynamic[T], error) {
+	f.mu.Lock()
+	if c := f.current; c != nil {
+		f.mu.Unlock()
+		<-c.done
+
+		return c.d, c.err
+	}
+
+	c := &flight[T]{
+		done: make(chan struct{}),
+		err:  errors.New("fxconfig: initial load panicked"),
+	}
+	f.current = c
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.current = nil
+		f.mu.Unlock()
+		close(c.done)
+	}()
+
+	d, err := loadUnmanaged(context.Background(), opts)
+	if err == nil {
+		d.watch(context.Background())
+		c.d = d
+	}
+	c.err = err
+
+	return c.d, c.err
+}
@@ -1,10 +1,297 @@
 package fxconfig
 
-import "schneider.vip/config"
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
 
 // New returns an constructor of a Dynamic Config and a parsed config of T.
+// The constructor panics if the config can't be loaded, use NewE to get the
+// error reported by fx instead. Otherwise it works like NewE.
 func New[T any](opts ...config.Option[T]) func() (config.Dynamic[T], T) {
+	newE := NewE(opts...)
+
 	return func() (config.Dynamic[T], T) {
-		return config.NewDynamic(opts...)
+		dyn, cfg, err := newE()
+		if err != nil {
+			panic(err)
+		}
+
+		return dyn, cfg
+	}
+}
+
+// NewE returns an constructor of a Dynamic Config and a parsed config of T.
+// If the config can't be loaded, the constructor returns the error, so
+// fx.New fails and app.Err() reports the cause. The file watcher runs until
+// the Dynamic Config is closed, use NewManaged to tie it to the fx lifecycle.
+//
+// Concurrent calls of the constructor, e.g. by fx apps built in parallel,
+// share one load: the source is read once and they all get the same Dynamic
+// Config. Calls after the load finished load again, so a failed load can
+// succeed later.
+func NewE[T any](opts ...config.Option[T]) func() (config.Dynamic[T], T, error) {
+	var loads flights[T]
+
+	return func() (config.Dynamic[T], T, error) {
+		d, err := loads.load(opts)
+		if err != nil {
+			var zero T
+			return nil, zero, err
+		}
+
+		return d, d.Load(), nil
+	}
+}
+
+// NewManaged returns an constructor like NewE, which ties the file watcher of
+// the Dynamic Config to the fx lifecycle: it starts when the app starts and
+// is stopped when the app stops. It also takes the fx.Shutdowner, so with
+// the Fatal reload failure policy a failed reload shuts the app down. Every
+// call loads the config of its own.
+func NewManaged[T any](opts ...config.Option[T]) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[T], T, error) {
+	return func(lc fx.Lifecycle, sd fx.Shutdowner) (config.Dynamic[T], T, error) {
+		d, err := load(opts)
+		if err != nil {
+			var zero T
+			return nil, zero, err
+		}
+
+		d.manage(lc, sd)
+
+		return d, d.Load(), nil
+	}
+}
+
+// manage ties the file watcher of d to the fx lifecycle: it starts in an
+// OnStart hook and stops in the OnStop hook. So no goroutine is started if
+// fx.New fails after the constructor ran or the app is never started.
+func (d *Dynamic[T]) manage(lc fx.Lifecycle, sd fx.Shutdowner) {
+	d.startupHook(lc)
+
+	if d.opts.static {
+		return
+	}
+
+	d.shutdowner = sd
+	lc.Append(fx.StartStopHook(func() { d.watch(context.Background()) }, d.Close))
+	d.verifyWatch(lc)
+}
+
+// NewFromFile returns an constructor like NewManaged, which reads the config
+// from the file at path, like with config.WithConfigFile. Unlike that, the
+// constructor fails if the file doesn't exist or can't be read, subject to
+// WithRetry. The file is watched for changes like with NewManaged.
+func NewFromFile[T any](path string, opts ...config.Option[T]) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[T], T, error) {
+	opts = append([]config.Option[T]{
+		config.WithConfigFile[T](path),
+		newOption(func(o *options[T]) { o.requireFile = true }),
+	}, opts...)
+
+	return NewManaged(opts...)
+}
+
+// NewWithContext returns an constructor like NewE, which takes a
+// context.Context from fx. If ctx is done before the initial load finished,
+// the constructor fails with the error of ctx, this also ends the retries of
+// WithRetry. When ctx is done later, the Dynamic Config is closed: the file
+// watcher and the error sink stop and their goroutines exit, the last config
+// stays available by Load. This ties the config to a context tree of the app
+// instead of, or in addition to, the fx lifecycle.
+func NewWithContext[T any](opts ...config.Option[T]) func(context.Context) (config.Dynamic[T], T, error) {
+	type result struct {
+		d   *Dynamic[T]
+		err error
+	}
+
+	return func(ctx context.Context) (config.Dynamic[T], T, error) {
+		var zero T
+
+		if err := ctx.Err(); err != nil {
+			return nil, zero, fmt.Errorf("fxconfig: initial load: %w", err)
+		}
+
+		res := make(chan result, 1)
+		go func() {
+			d, err := loadUnmanaged(ctx, opts)
+			res <- result{d, err}
+		}()
+
+		select {
+		case r := <-res:
+			if r.err != nil {
+				return nil, zero, r.err
+			}
+
+			r.d.watch(ctx)
+
+			return r.d, r.d.Load(), nil
+		case <-ctx.Done():
+			return nil, zero, fmt.Errorf("fxconfig: initial load: %w", ctx.Err())
+		}
+	}
+}
+
+// NewValue returns an constructor of the parsed config of T only, for
+// consumers which don't need reloads. The config is loaded like by NewE, but
+// no file watcher is started.
+func NewValue[T any](opts ...config.Option[T]) func() (T, error) {
+	return func() (T, error) {
+		d, err := loadUnmanaged(context.Background(), opts)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+
+		return d.Load(), nil
+	}
+}
+
+// loadUnmanaged loads the config like loadContext for a constructor without
+// the fx lifecycle. It fails if an option needs the lifecycle, instead of
+// ignoring the option silently.
+func loadUnmanaged[T any](ctx context.Context, opts []config.Option[T]) (*Dynamic[T], error) {
+	d, err := loadContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.opts.unmanaged(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// NewAnnotated returns the constructor of NewManaged annotated by anns, see
+// fx.Annotate, e.g. to put the configs into a value group or to tag them for
+// a consumer. fx.ResultTags apply to the results in order, the Dynamic
+// Config first and the parsed config of T second. Use Tag to tag both
+// consistently:
+//
+//	fx.Provide(fxconfig.NewAnnotated([]fx.Annotation{fxconfig.Tag(`group:"configs"`)}, opts...))
+func NewAnnotated[T any](anns []fx.Annotation, opts ...config.Option[T]) any {
+	return fx.Annotate(NewManaged(opts...), anns...)
+}
+
+// Tag returns an fx.ResultTags annotation, which tags both results of
+// NewManaged, the Dynamic Config and the parsed config, with tag.
+func Tag(tag string) fx.Annotation {
+	return fx.ResultTags(tag, tag)
+}
+
+// NewAs returns an constructor like NewManaged, which provides the parsed
+// config of T as the interface I instead of T. This keeps config types out of
+// packages which depend on a narrow interface only:
+//
+//	type URLProvider interface{ ServiceURL() string }
+//
+//	fx.Provide(fxconfig.NewAs[ServiceConfig, URLProvider](opts...))
+//
+// T or *T must implement I, otherwise the constructor fails. With a pointer
+// receiver, I wraps a pointer to a copy of the config.
+func NewAs[T, I any](opts ...config.Option[T]) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[T], I, error) {
+	newManaged := NewManaged(opts...)
+	typ, iface := reflect.TypeFor[T](), reflect.TypeFor[I]()
+
+	return func(lc fx.Lifecycle, sd fx.Shutdowner) (config.Dynamic[T], I, error) {
+		var zero I
+
+		switch {
+		case iface.Kind() != reflect.Interface:
+			return nil, zero, fmt.Errorf("fxconfig: %s is not an interface", iface)
+		case !typ.Implements(iface) && !reflect.PointerTo(typ).Implements(iface):
+			return nil, zero, fmt.Errorf("fxconfig: neither %s nor *%s implement %s", typ, typ, iface)
+		}
+
+		dyn, cfg, err := newManaged(lc, sd)
+		if err != nil {
+			return nil, zero, err
+		}
+
+		if i, ok := any(cfg).(I); ok {
+			return dyn, i, nil
+		}
+
+		return dyn, any(&cfg).(I), nil
+	}
+}
+
+// NewPtr returns an constructor like NewManaged, which provides a pointer to
+// the parsed config of T instead of T, for consumers which keep or pass
+// around a *T. The pointer refers to a deep copy of the config at startup:
+// it is a snapshot, which doesn't change on reloads, and modifying it
+// doesn't affect the Dynamic Config. Consumers which need the latest config
+// must use Load of the Dynamic Config.
+func NewPtr[T any](opts ...config.Option[T]) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[T], *T, error) {
+	newManaged := NewManaged(opts...)
+
+	return func(lc fx.Lifecycle, sd fx.Shutdowner) (config.Dynamic[T], *T, error) {
+		dyn, cfg, err := newManaged(lc, sd)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cfg = deepCopy(cfg)
+
+		return dyn, &cfg, nil
+	}
+}
+
+// Module returns an fx.Module which provides the Dynamic Config and the
+// parsed config of T, like fx.Provide(NewManaged(opts...)). The Dynamic
+// Config is also provided as Loader[T], as *Dynamic[T] for reload control,
+// by its *Health[T], *Status[T] and ConfigDescriptor. The module is named
+// after T, e.g. "fxconfig[main.ConfigSection]", so it can be told apart in
+// fx's logs and graph dumps. Modules of different types don't collide, as fx
+// keys the results by T. Use New or NewE for more advanced wiring.
+func Module[T any](opts ...config.Option[T]) fx.Option {
+	return fx.Module(
+		fmt.Sprintf("fxconfig[%s]", reflect.TypeFor[T]()),
+		fx.Provide(
+			NewManaged(opts...),
+			AsLoader[T],
+			asDynamic[T],
+			NewHealth[T],
+			NewStatus[T],
+		),
+		WithDescriptor[T](),
+	)
+}
+
+// Loader is the part of config.Dynamic[T] most consumers need. Depending on
+// Loader instead of config.Dynamic[T] makes it easy to replace the config by
+// a stub in tests, e.g. with fx.Decorate.
+type Loader[T any] interface {
+	Load() T
+}
+
+// AsLoader is a constructor which provides the Dynamic Config as Loader[T].
+// Module provides it already, with New or NewE use:
+//
+//	fx.Provide(fxconfig.NewE(opts...), fxconfig.AsLoader[ServiceConfig])
+func AsLoader[T any](dyn config.Dynamic[T]) Loader[T] {
+	return dyn
+}
+
+// NewNamed returns an fx.Annotated constructor like NewManaged, whose
+// results, the Dynamic Config and the parsed config of T, are both named
+// name. This allows to provide several configs of the same type, e.g. from
+// different sub sections. Consumers select one by its name:
+//
+//	type Params struct {
+//		fx.In
+//
+//		Dynamic config.Dynamic[ServiceConfig] `name:"primary"`
+//		Config  ServiceConfig                 `name:"primary"`
+//	}
+func NewNamed[T any](name string, opts ...config.Option[T]) fx.Annotated {
+	return fx.Annotated{
+		Name:   name,
+		Target: NewManaged(opts...),
 	}
 }
@@ -0,0 +1,2629 @@
+package fxconfig_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/goleak"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+)
+
+type testConfig struct {
+	URL string
+}
+
+// writeConfig writes the ServiceConfig section with url to path.
+func writeConfig(t *testing.T, path, url string) {
+	t.Helper()
+
+	data := "ServiceConfig:\n  URL: " + url + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// eventually fails the test if cond does not become true within a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewManaged(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var dyn config.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fx.Provide(fxconfig.NewManaged(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		)),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+
+	if got := dyn.Load().URL; got != "first.example.com" {
+		t.Fatalf("URL = %q, want first.example.com", got)
+	}
+
+	writeConfig(t, path, "second.example.com")
+	eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+
+	app.RequireStop()
+}
+
+func TestNewManagedFailedApp(t *testing.T) {
+	type missing struct{}
+	type server struct{}
+
+	newManaged := func(t *testing.T) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[testConfig], testConfig, error) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		return fxconfig.NewManaged(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		)
+	}
+
+	t.Run("missing dependency", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+		app := fx.New(
+			fx.NopLogger,
+			fx.Provide(newManaged(t)),
+			fx.Invoke(func(config.Dynamic[testConfig], missing) {}),
+		)
+		if app.Err() == nil {
+			t.Fatal("fx.New() succeeded with a missing dependency")
+		}
+	})
+
+	t.Run("failing provider", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+		app := fx.New(
+			fx.NopLogger,
+			fx.Provide(
+				newManaged(t),
+				func(config.Dynamic[testConfig]) (*server, error) {
+					return nil, errors.New("later provider failed")
+				},
+			),
+			fx.Invoke(func(*server) {}),
+		)
+		if app.Err() == nil {
+			t.Fatal("fx.New() succeeded with a failing provider")
+		}
+	})
+
+	t.Run("never started", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+		app := fx.New(
+			fx.NopLogger,
+			fx.Provide(newManaged(t)),
+			fx.Invoke(func(config.Dynamic[testConfig]) {}),
+		)
+		if err := app.Err(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestOnReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	changes := make(chan [2]string, 10)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fxconfig.OnReload(func(old, new testConfig) {
+			panic("must not stop the watcher")
+		}),
+		fxconfig.OnReload(func(old, new testConfig) {
+			changes <- [2]string{old.URL, new.URL}
+		}),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	writeConfig(t, path, "first.example.com")
+	writeConfig(t, path, "second.example.com")
+
+	select {
+	case got := <-changes:
+		if got != [2]string{"first.example.com", "second.example.com"} {
+			t.Fatalf("OnReload got %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnReload was not called")
+	}
+}
+
+func TestOnReloadCtx(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		status *fxconfig.Status[testConfig]
+		events []fxconfig.ReloadEvent[testConfig]
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fxconfig.OnReloadCtx(func(ev fxconfig.ReloadEvent[testConfig]) {
+			events = append(events, ev)
+		}),
+		fx.Populate(&dyn, &status),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	start := time.Now()
+	writeConfig(t, path, "second.example.com")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	dyn.Close()
+
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+
+	ev := events[0]
+	if ev.Old.URL != "first.example.com" || ev.New.URL != "second.example.com" || ev.Generation != 2 {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	if ev.Time.Before(start) || ev.Time.After(status.LastReload()) {
+		t.Fatalf("event time %v, want between %v and the last reload %v", ev.Time, start, status.LastReload())
+	}
+}
+
+func TestOnReloadSlowCallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "v0.example.com")
+
+	ignore := goleak.IgnoreCurrent()
+
+	var (
+		running, maxRunning, calls, reloads atomic.Int32
+		latest                              atomic.Value
+		dyn                                 *fxconfig.Dynamic[testConfig]
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fxconfig.OnReload(func(_, new testConfig) {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for m := maxRunning.Load(); n > m && !maxRunning.CompareAndSwap(m, n); m = maxRunning.Load() {
+			}
+
+			calls.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			latest.Store(new.URL)
+		}),
+		fx.Populate(&dyn),
+	)
+	dyn.SetOnChangeFunc(func(error) { reloads.Add(1) })
+	app.RequireStart()
+
+	const changes = 30
+	for i := 1; i <= changes; i++ {
+		writeConfig(t, path, fmt.Sprintf("v%d.example.com", i))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	want := fmt.Sprintf("v%d.example.com", changes)
+	deadline := time.Now().Add(5 * time.Second)
+
+	for latest.Load() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("last callback saw %v, want %s", latest.Load(), want)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	app.RequireStop()
+
+	if n := maxRunning.Load(); n != 1 {
+		t.Errorf("%d callbacks ran concurrently, want 1", n)
+	}
+
+	// 30 changes within 150ms collapse while the callback sleeps 100ms.
+	if n := calls.Load(); n > 10 {
+		t.Errorf("callback ran %d times for %d changes, want the changes collapsed", n, changes)
+	}
+
+	// At most one reload is pending while the callback runs, so there is
+	// about one reload per callback, not one per change.
+	if n, max := reloads.Load(), 2*calls.Load()+2; n > max {
+		t.Errorf("%d reloads for %d callbacks, want at most %d", n, calls.Load(), max)
+	}
+
+	eventually(t, func() bool { return goleak.Find(ignore) == nil })
+}
+
+func validURL(c testConfig) error {
+	if !strings.HasSuffix(c.URL, ".example.com") {
+		return fmt.Errorf("invalid URL %q", c.URL)
+	}
+
+	return nil
+}
+
+func TestWithValidator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+
+	t.Run("initial", func(t *testing.T) {
+		writeConfig(t, path, "invalid")
+
+		app := fx.New(
+			fx.NopLogger,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithValidator(validURL),
+			),
+			fx.Invoke(func(testConfig) {}),
+		)
+
+		if err := app.Err(); err == nil || !strings.Contains(err.Error(), `invalid URL "invalid"`) {
+			t.Fatalf("app.Err() = %v", err)
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		writeConfig(t, path, "first.example.com")
+
+		errs := make(chan error, 10)
+
+		var dyn config.Dynamic[testConfig]
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithValidator(validURL),
+			),
+			fx.Populate(&dyn),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		dyn.SetOnChangeFunc(func(err error) {
+			if err != nil {
+				errs <- err
+			}
+		})
+
+		writeConfig(t, path, "invalid")
+
+		select {
+		case <-errs:
+		case <-time.After(time.Second):
+			t.Fatal("invalid reload was not reported")
+		}
+
+		if got := dyn.Load().URL; got != "first.example.com" {
+			t.Fatalf("URL = %q, want the last valid first.example.com", got)
+		}
+	})
+}
+
+func TestWithReloadGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "rejected.example.com")
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithReloadGuard(func(c testConfig) error {
+				if c.URL == "rejected.example.com" {
+					return errors.New("rejected")
+				}
+
+				return nil
+			}),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// The guard does not run on the initial load.
+	if got := dyn.Load().URL; got != "rejected.example.com" {
+		t.Fatalf("URL = %q, want rejected.example.com", got)
+	}
+
+	writeConfig(t, path, "accepted.example.com")
+	if err := dyn.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	writeConfig(t, path, "rejected.example.com")
+	if err := dyn.Reload(); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("Reload = %v, want rejected", err)
+	}
+
+	if got := dyn.Load().URL; got != "accepted.example.com" {
+		t.Fatalf("URL = %q, want accepted.example.com", got)
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if gen := dyn.Generation(); gen != 1 {
+		t.Fatalf("Generation = %d, want 1", gen)
+	}
+
+	// An unchanged config is not committed again.
+	if err := dyn.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if gen := dyn.Generation(); gen != 1 {
+		t.Fatalf("Generation = %d after unchanged reload, want 1", gen)
+	}
+
+	writeConfig(t, path, "second.example.com")
+	eventually(t, func() bool { return dyn.Generation() == 2 })
+
+	if cfg, gen := dyn.Snapshot(); cfg.URL != "second.example.com" || gen != 2 {
+		t.Fatalf("Snapshot = %q, %d, want second.example.com, 2", cfg.URL, gen)
+	}
+}
+
+func TestNewWithContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	opts := []config.Option[testConfig]{
+		config.WithConfigFile[testConfig](path),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := fxconfig.NewWithContext(opts...)(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("loaded", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dyn, cfg, err := fxconfig.NewWithContext(opts...)(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.URL != "first.example.com" {
+			t.Fatalf("URL = %q, want first.example.com", cfg.URL)
+		}
+
+		writeConfig(t, path, "second.example.com")
+		eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+	})
+
+	t.Run("cancel stops the watcher", func(t *testing.T) {
+		ignore := goleak.IgnoreCurrent()
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		opts := append(opts, fxconfig.WithErrorSink[testConfig](func(error) {}))
+
+		dyn, _, err := fxconfig.NewWithContext(opts...)(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cancel()
+
+		// The goroutines of the watcher and the error sink exit, the config
+		// stays available.
+		if err := goleak.Find(ignore); err != nil {
+			t.Fatal(err)
+		}
+
+		writeConfig(t, path, "third.example.com")
+		time.Sleep(50 * time.Millisecond)
+
+		if got := dyn.Load().URL; got == "third.example.com" {
+			t.Fatal("reloaded after cancel")
+		}
+	})
+
+	t.Run("fx", func(t *testing.T) {
+		writeConfig(t, path, "fx.example.com")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var cfg testConfig
+
+		app := fxtest.New(t,
+			fx.Supply(fx.Annotate(ctx, fx.As(new(context.Context)))),
+			fx.Provide(fxconfig.NewWithContext(opts...)),
+			fx.Populate(&cfg),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		if cfg.URL != "fx.example.com" {
+			t.Fatalf("URL = %q, want fx.example.com", cfg.URL)
+		}
+	})
+}
+
+type defaultConfig struct {
+	URL     string
+	Enabled bool `mapstructure:",omitempty"`
+	Labels  map[string]string
+}
+
+func TestWithRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+
+	opts := []config.Option[testConfig]{
+		config.WithConfigFile[testConfig](path),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+		fxconfig.WithRetry[testConfig](20, 10*time.Millisecond),
+	}
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err := fxconfig.NewWithContext(opts...)(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("appears", func(t *testing.T) {
+		time.AfterFunc(50*time.Millisecond, func() { writeConfig(t, path, "late.example.com") })
+
+		cfg, err := fxconfig.NewValue(opts...)()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.URL != "late.example.com" {
+			t.Fatalf("URL = %q, want late.example.com", cfg.URL)
+		}
+	})
+}
+
+func TestWithDefault(t *testing.T) {
+	def := defaultConfig{
+		URL:     "default.example.com",
+		Enabled: true,
+		Labels:  map[string]string{"env": "default"},
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		want   defaultConfig
+	}{
+		{
+			name:   "missing section",
+			config: "Other:\n  URL: other.example.com\n",
+			want:   def,
+		},
+		{
+			name:   "missing keys",
+			config: "ServiceConfig:\n  URL: example.com\n",
+			want: defaultConfig{
+				URL:     "example.com",
+				Enabled: true,
+				Labels:  map[string]string{"env": "default"},
+			},
+		},
+		{
+			name:   "explicit false",
+			config: "ServiceConfig:\n  Enabled: false\n  Labels:\n    team: core\n",
+			want: defaultConfig{
+				URL:     "default.example.com",
+				Enabled: false,
+				Labels:  map[string]string{"env": "default", "team": "core"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := fxconfig.NewValue(
+				config.WithConfigReader[defaultConfig](strings.NewReader(tt.config), "yaml"),
+				config.WithSubSection[defaultConfig]("ServiceConfig"),
+				fxconfig.WithDefault(def),
+			)()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Fatalf("config = %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+
+	if len(def.Labels) != 1 {
+		t.Fatalf("default was modified: %v", def.Labels)
+	}
+}
+
+func TestWithSignalReload(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	reloads := make(chan error, 10)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fx.Invoke(func(dyn config.Dynamic[testConfig]) {
+			dyn.SetOnChangeFunc(func(err error) { reloads <- err })
+		}),
+		fxconfig.WithSignalReload[testConfig](syscall.SIGHUP),
+	)
+	app.RequireStart()
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SIGHUP did not reload the config")
+	}
+
+	app.RequireStop()
+}
+
+func TestWithDebounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var (
+		dyn     config.Dynamic[testConfig]
+		reloads atomic.Int32
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithDebounce[testConfig](200*time.Millisecond),
+		),
+		fxconfig.OnReload(func(old, new testConfig) { reloads.Add(1) }),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+
+	for i := range 5 {
+		writeConfig(t, path, fmt.Sprintf("%d.example.com", i))
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	eventually(t, func() bool { return dyn.Load().URL == "4.example.com" })
+
+	if n := reloads.Load(); n != 1 {
+		t.Fatalf("reloaded %d times, want 1", n)
+	}
+
+	// A pending change is reloaded on stop.
+	writeConfig(t, path, "last.example.com")
+	time.Sleep(50 * time.Millisecond)
+	app.RequireStop()
+
+	if got := dyn.Load().URL; got != "last.example.com" {
+		t.Fatalf("URL = %q, want last.example.com", got)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		loader fxconfig.Loader[testConfig]
+		cfg    testConfig
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Static(testConfig{URL: "static.example.com"}),
+		fx.Populate(&dyn, &loader, &cfg),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if got := loader.Load().URL; got != "static.example.com" {
+				t.Errorf("URL = %q, want static.example.com", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if cfg.URL != "static.example.com" {
+		t.Fatalf("URL = %q, want static.example.com", cfg.URL)
+	}
+}
+
+type stressConfig struct {
+	N     int
+	Name  string
+	Check int
+}
+
+// TestLoadConsistency reloads rapidly while many goroutines load the config,
+// each observed config must belong to exactly one generation.
+func TestLoadConsistency(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+
+	// write replaces the config file atomically, so no reload reads a
+	// partially written file.
+	write := func(n int) {
+		tmp := filepath.Join(dir, "config.tmp")
+		data := fmt.Sprintf("Stress:\n  N: %d\n  Name: config-%d\n  Check: %d\n", n, n, -n)
+
+		if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(0)
+
+	var dyn *fxconfig.Dynamic[stressConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[stressConfig](path),
+			config.WithSubSection[stressConfig]("Stress"),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	var (
+		stop atomic.Bool
+		wg   sync.WaitGroup
+	)
+
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for !stop.Load() {
+				c := dyn.Load()
+				if c.Name != fmt.Sprintf("config-%d", c.N) || c.Check != -c.N {
+					t.Errorf("torn config %+v", c)
+					return
+				}
+			}
+		}()
+	}
+
+	for n := 1; n <= 200; n++ {
+		write(n)
+
+		if err := dyn.Reload(); err != nil {
+			t.Errorf("Reload: %v", err)
+		}
+	}
+
+	stop.Store(true)
+	wg.Wait()
+
+	if got := dyn.Load().N; got != 200 {
+		t.Fatalf("N = %d, want 200", got)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		status *fxconfig.Status[testConfig]
+		cfg    testConfig
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Disabled[testConfig](),
+		fx.Populate(&dyn, &status, &cfg),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if cfg != (testConfig{}) || dyn.Load() != (testConfig{}) {
+		t.Fatalf("config = %+v, want the zero config", dyn.Load())
+	}
+
+	if view := status.View(); view.Watching || view.Source != "" || view.Generation != 1 {
+		t.Fatalf("status = %+v", view)
+	}
+}
+
+func TestWithErrorSink(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	errs := make(chan error, 10)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithErrorSink[testConfig](func(err error) { errs <- err }),
+		),
+		fx.Invoke(func(testConfig) {}),
+	)
+	app.RequireStart()
+
+	if err := os.WriteFile(path, []byte("ServiceConfig: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("reload error was not reported")
+	}
+
+	app.RequireStop()
+}
+
+func TestNewAsNotImplemented(t *testing.T) {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(fxconfig.NewAs[testConfig, fmt.Stringer](
+			config.WithConfigReader[testConfig](strings.NewReader("ServiceConfig:\n  URL: a.example.com\n"), "yaml"),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		)),
+		fx.Invoke(func(fmt.Stringer) {}),
+	)
+
+	if err := app.Err(); err == nil || !strings.Contains(err.Error(), "implement fmt.Stringer") {
+		t.Fatalf("app.Err() = %v", err)
+	}
+}
+
+func TestWithReloadFailurePolicy(t *testing.T) {
+	corrupt := func(t *testing.T, path string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte("ServiceConfig: ["), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("KeepLast", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		errs := make(chan error, 10)
+
+		var dyn *fxconfig.Dynamic[testConfig]
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithErrorSink[testConfig](func(err error) { errs <- err }),
+			),
+			fx.Populate(&dyn),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		corrupt(t, path)
+
+		if err := dyn.Reload(); err == nil {
+			t.Fatal("Reload of a corrupted config succeeded")
+		}
+
+		if got := dyn.Load().URL; got != "first.example.com" {
+			t.Fatalf("URL = %q, want the last first.example.com", got)
+		}
+
+		select {
+		case <-errs:
+		case <-time.After(time.Second):
+			t.Fatal("failed reload was not reported to the error sink")
+		}
+	})
+
+	t.Run("Fatal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		var (
+			dyn     *fxconfig.Dynamic[testConfig]
+			stopped atomic.Bool
+		)
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithReloadFailurePolicy[testConfig](fxconfig.Fatal),
+			),
+			fx.Invoke(func(lc fx.Lifecycle) {
+				lc.Append(fx.StopHook(func() { stopped.Store(true) }))
+			}),
+			fx.Populate(&dyn),
+		)
+		app.RequireStart()
+
+		corrupt(t, path)
+		dyn.Reload()
+
+		select {
+		case sig := <-app.Wait():
+			if sig.ExitCode != fxconfig.FatalExitCode {
+				t.Fatalf("ExitCode = %d, want %d", sig.ExitCode, fxconfig.FatalExitCode)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("failed reload did not shut the app down")
+		}
+
+		app.RequireStop()
+
+		if !stopped.Load() {
+			t.Fatal("OnStop hooks did not run")
+		}
+	})
+
+	t.Run("Fatal without a shutdowner", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		opts := []config.Option[testConfig]{
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithReloadFailurePolicy[testConfig](fxconfig.Fatal),
+		}
+
+		if _, _, err := fxconfig.NewE(opts...)(); err == nil || !strings.Contains(err.Error(), "Fatal") {
+			t.Fatalf("NewE() = %v, want an error naming the Fatal policy", err)
+		}
+
+		if _, err := fxconfig.NewValue(opts...)(); err == nil || !strings.Contains(err.Error(), "Fatal") {
+			t.Fatalf("NewValue() = %v, want an error naming the Fatal policy", err)
+		}
+	})
+}
+
+type envConfig struct {
+	URL     string
+	Enabled bool `mapstructure:",omitempty"`
+	Timeout time.Duration
+	Hosts   []string
+	TLS     *struct {
+		CertFile string
+	}
+}
+
+func TestWithEnvPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "file.example.com")
+
+	t.Setenv("APP_SERVICECONFIG_ENABLED", "TRUE")
+	t.Setenv("APP_SERVICECONFIG_TIMEOUT", "5s")
+	t.Setenv("APP_SERVICECONFIG_HOSTS", "a, b")
+	t.Setenv("APP_SERVICECONFIG_TLS_CERTFILE", "cert.pem")
+
+	opts := []config.Option[envConfig]{
+		config.WithConfigFile[envConfig](path),
+		config.WithSubSection[envConfig]("ServiceConfig"),
+		fxconfig.WithEnvPrefix[envConfig]("app"),
+	}
+
+	var dyn *fxconfig.Dynamic[envConfig]
+
+	app := fxtest.New(t, fxconfig.Module(opts...), fx.Populate(&dyn))
+	app.RequireStart()
+	defer app.RequireStop()
+
+	got := dyn.Load()
+	if got.URL != "file.example.com" || !got.Enabled || got.Timeout != 5*time.Second ||
+		!reflect.DeepEqual(got.Hosts, []string{"a", "b"}) || got.TLS == nil || got.TLS.CertFile != "cert.pem" {
+		t.Fatalf("config = %+v", got)
+	}
+
+	// The environment stays authoritative on reloads.
+	t.Setenv("APP_SERVICECONFIG_URL", "env.example.com")
+	writeConfig(t, path, "second.example.com")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dyn.Load().URL; got != "env.example.com" {
+		t.Fatalf("URL = %q, want env.example.com", got)
+	}
+
+	t.Setenv("APP_SERVICECONFIG_ENABLED", "yes")
+
+	if _, err := fxconfig.NewValue(opts...)(); err == nil || !strings.Contains(err.Error(), "APP_SERVICECONFIG_ENABLED") {
+		t.Fatalf("err = %v, want invalid APP_SERVICECONFIG_ENABLED", err)
+	}
+}
+
+func TestWithRawSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	sums := make(chan [sha256.Size]byte, 10)
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithRawSink[testConfig](func(raw []byte) { sums <- sha256.Sum256(raw) }),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	for _, url := range []string{"first.example.com", "second.example.com"} {
+		if url != "first.example.com" {
+			writeConfig(t, path, url)
+
+			if err := dyn.Reload(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(dyn.Raw(), want) {
+			t.Fatalf("Raw = %q, want %q", dyn.Raw(), want)
+		}
+
+		if got := <-sums; got != sha256.Sum256(want) {
+			t.Fatalf("raw sink got a checksum of other bytes for %s", url)
+		}
+	}
+}
+
+func TestWithStatic(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithStatic[testConfig](),
+		),
+		fxconfig.OnReload(func(old, new testConfig) { t.Error("OnReload called") }),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if err := goleak.Find(ignore); err != nil {
+		t.Fatalf("static config started a goroutine: %v", err)
+	}
+
+	writeConfig(t, path, "second.example.com")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dyn.Load().URL; got != "first.example.com" {
+		t.Fatalf("URL = %q, want the initial first.example.com", got)
+	}
+}
+
+func TestWithMinReloadInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	const interval = 300 * time.Millisecond
+
+	var (
+		dyn config.Dynamic[testConfig]
+		mu  sync.Mutex
+		at  []time.Time
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithMinReloadInterval[testConfig](interval),
+		),
+		fxconfig.OnReload(func(old, new testConfig) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			at = append(at, time.Now())
+		}),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+
+	for i := range 10 {
+		writeConfig(t, path, fmt.Sprintf("%d.example.com", i))
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	eventually(t, func() bool { return dyn.Load().URL == "9.example.com" })
+
+	mu.Lock()
+	for i := 1; i < len(at); i++ {
+		if gap := at[i].Sub(at[i-1]); gap < interval-50*time.Millisecond {
+			t.Errorf("reloads %v apart, want at least %v", gap, interval)
+		}
+	}
+
+	if len(at) > 2 {
+		t.Errorf("reloaded %d times, want at most 2", len(at))
+	}
+	mu.Unlock()
+
+	// A waiting change is reloaded on stop.
+	writeConfig(t, path, "last.example.com")
+	time.Sleep(50 * time.Millisecond)
+	app.RequireStop()
+
+	if got := dyn.Load().URL; got != "last.example.com" {
+		t.Fatalf("URL = %q, want last.example.com", got)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		health *fxconfig.Health[testConfig]
+	)
+
+	start := time.Now()
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fx.Populate(&dyn, &health),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	loaded := health.LastReload()
+	if loaded.Before(start) || health.Check() != nil || health.LastError() != nil {
+		t.Fatalf("initial health: %v, %v", loaded, health.Check())
+	}
+
+	if err := os.WriteFile(path, []byte("ServiceConfig: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dyn.Reload()
+
+	err := health.Check()
+	if err == nil || !strings.Contains(err.Error(), "fxconfig_test.testConfig") {
+		t.Fatalf("Check = %v, want a failure naming the config type", err)
+	}
+
+	if !health.LastReload().Equal(loaded) {
+		t.Fatal("failed reload changed LastReload")
+	}
+
+	writeConfig(t, path, "first.example.com")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if health.Check() != nil || !health.LastReload().After(loaded) {
+		t.Fatalf("health after reload: %v, %v", health.LastReload(), health.Check())
+	}
+}
+
+func TestStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		status *fxconfig.Status[testConfig]
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithDebounce[testConfig](50*time.Millisecond),
+		),
+		fx.Populate(&dyn, &status),
+	)
+	app.RequireStart()
+
+	view := status.View()
+	if view.Generation != 1 || !view.Watching || view.Source != path || view.LastError != nil ||
+		view.Name != "fxconfig_test.testConfig" || view.LastReload.IsZero() {
+		t.Fatalf("initial status = %+v", view)
+	}
+
+	writeConfig(t, path, "second.example.com")
+	eventually(t, func() bool { return status.Generation() == 2 })
+
+	if err := os.WriteFile(path, []byte("ServiceConfig: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	dyn.Reload()
+
+	if view := status.View(); view.LastError == nil || view.Generation != 2 {
+		t.Fatalf("status after a failed reload = %+v", view)
+	}
+
+	app.RequireStop()
+
+	if status.Watching() {
+		t.Fatal("Watching() = true after stop")
+	}
+}
+
+func TestSwitchSource(t *testing.T) {
+	blue := filepath.Join(t.TempDir(), "blue.yml")
+	green := filepath.Join(t.TempDir(), "green.yml")
+	writeConfig(t, blue, "blue.example.com")
+	writeConfig(t, green, "green.example.com")
+
+	ignore := goleak.IgnoreCurrent()
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		status *fxconfig.Status[testConfig]
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](blue),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithDebounce[testConfig](50*time.Millisecond),
+		),
+		fx.Populate(&dyn, &status),
+	)
+	app.RequireStart()
+
+	err := dyn.SwitchSource(
+		config.WithConfigFile[testConfig](green),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg, gen := dyn.Snapshot(); cfg.URL != "green.example.com" || gen != 2 || status.Source() != green {
+		t.Fatalf("after switch: %q, generation %d, source %q", cfg.URL, gen, status.Source())
+	}
+
+	// The old source is not watched anymore, the new one is.
+	writeConfig(t, blue, "changed.example.com")
+	writeConfig(t, green, "new-green.example.com")
+	eventually(t, func() bool { return dyn.Load().URL == "new-green.example.com" })
+
+	if gen := dyn.Generation(); gen != 3 {
+		t.Fatalf("Generation() = %d, want 3", gen)
+	}
+
+	err = dyn.SwitchSource(
+		config.WithConfigFile[testConfig](filepath.Join(t.TempDir(), "missing.yml")),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+	)
+	if err == nil {
+		t.Fatal("switching to a missing file succeeded")
+	}
+
+	if got := dyn.Load().URL; got != "new-green.example.com" || status.Source() != green {
+		t.Fatalf("after a failed switch: %q from %q", got, status.Source())
+	}
+
+	app.RequireStop()
+
+	if err := dyn.SwitchSource(config.WithConfigFile[testConfig](blue)); err == nil {
+		t.Fatal("switching a closed config succeeded")
+	}
+
+	eventually(t, func() bool { return goleak.Find(ignore) == nil })
+}
+
+func TestMap(t *testing.T) {
+	parse := func(c testConfig) (*url.URL, error) {
+		u, err := url.Parse(c.URL)
+		if err == nil && u.Host == "" {
+			err = fmt.Errorf("no host in %q", c.URL)
+		}
+
+		return u, err
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+
+	t.Run("initial", func(t *testing.T) {
+		writeConfig(t, path, "invalid")
+
+		app := fx.New(
+			fx.NopLogger,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+			),
+			fxconfig.Map(parse),
+			fx.Invoke(func(*url.URL) {}),
+		)
+
+		if err := app.Err(); err == nil || !strings.Contains(err.Error(), `no host in "invalid"`) {
+			t.Fatalf("app.Err() = %v", err)
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		writeConfig(t, path, "https://first.example.com")
+
+		var (
+			dyn     *fxconfig.Dynamic[testConfig]
+			derived config.Dynamic[*url.URL]
+		)
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+			),
+			fxconfig.Map(parse),
+			fx.Populate(&dyn, &derived),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		if got := derived.Load().Host; got != "first.example.com" {
+			t.Fatalf("Host = %q, want first.example.com", got)
+		}
+
+		writeConfig(t, path, "https://second.example.com")
+		eventually(t, func() bool { return derived.Load().Host == "second.example.com" })
+
+		writeConfig(t, path, "invalid")
+		eventually(t, func() bool { return dyn.Load().URL == "invalid" })
+
+		if got := derived.Load().Host; got != "second.example.com" {
+			t.Fatalf("Host = %q, want the last second.example.com", got)
+		}
+	})
+}
+
+func TestOverride(t *testing.T) {
+	// The source of the real module doesn't exist, it must not be read.
+	realModule := fxconfig.Module(
+		config.WithConfigFile[testConfig](filepath.Join(t.TempDir(), "missing.yml")),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+	)
+
+	var (
+		dyn    config.Dynamic[testConfig]
+		loader fxconfig.Loader[testConfig]
+		cfg    testConfig
+	)
+
+	app := fxtest.New(t,
+		realModule,
+		fxconfig.Override(testConfig{URL: "override.example.com"}),
+		fx.Populate(&dyn, &loader, &cfg),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	for _, got := range []string{dyn.Load().URL, loader.Load().URL, cfg.URL} {
+		if got != "override.example.com" {
+			t.Fatalf("URL = %q, want override.example.com", got)
+		}
+	}
+}
+
+func TestWithPollInterval(t *testing.T) {
+	t.Run("reloads polled changes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		var dyn config.Dynamic[testConfig]
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithPollInterval[testConfig](20*time.Millisecond),
+			),
+			fx.Populate(&dyn),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		writeConfig(t, path, "second.example.com")
+		eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+	})
+
+	t.Run("rejects a non-positive interval", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		_, _, err := fxconfig.NewE(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithPollInterval[testConfig](0),
+		)()
+		if err == nil || !strings.Contains(err.Error(), "poll interval") {
+			t.Fatalf("err = %v, want poll interval error", err)
+		}
+	})
+}
+
+func TestOnFirstLoad(t *testing.T) {
+	t.Run("runs once", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, path, "first.example.com")
+
+		var (
+			dyn   config.Dynamic[testConfig]
+			calls atomic.Int32
+			first atomic.Value
+		)
+
+		app := fxtest.New(t,
+			fxconfig.Module(
+				config.WithConfigFile[testConfig](path),
+				config.WithSubSection[testConfig]("ServiceConfig"),
+			),
+			fxconfig.OnFirstLoad(func(cfg testConfig) error {
+				calls.Add(1)
+				first.Store(cfg.URL)
+
+				return nil
+			}),
+			fx.Populate(&dyn),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		writeConfig(t, path, "second.example.com")
+		eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+
+		if n := calls.Load(); n != 1 {
+			t.Errorf("called %d times, want 1", n)
+		}
+
+		if url := first.Load(); url != "first.example.com" {
+			t.Errorf("called with %v, want first.example.com", url)
+		}
+	})
+
+	t.Run("aborts the start", func(t *testing.T) {
+		errHook := errors.New("webhook failed")
+
+		app := fx.New(
+			fx.NopLogger,
+			fxconfig.Static(testConfig{URL: "static.example.com"}),
+			fxconfig.OnFirstLoad(func(testConfig) error { return errHook }),
+		)
+
+		if err := app.Start(context.Background()); !errors.Is(err, errHook) {
+			t.Fatalf("Start() = %v, want %v", err, errHook)
+		}
+	})
+}
+
+// panicObserver records the errors of failed reloads and of callback panics.
+type panicObserver struct {
+	failed, panicked chan error
+}
+
+func (o panicObserver) Reloaded(string, uint64)              {}
+func (o panicObserver) ReloadFailed(_ string, err error)     { o.failed <- err }
+func (o panicObserver) CallbackPanicked(_ string, err error) { o.panicked <- err }
+
+func TestReloadPanic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		health *fxconfig.Health[testConfig]
+	)
+
+	errs := make(chan error, 10)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithErrorSink[testConfig](func(err error) { errs <- err }),
+			// The writes settle, so no partially written config is reported.
+			fxconfig.WithDebounce[testConfig](50*time.Millisecond),
+			fxconfig.WithValidator(func(c testConfig) error {
+				if c.URL == "validator.example.com" {
+					panic("validator bug")
+				}
+
+				return nil
+			}),
+		),
+		fxconfig.OnReload(func(old, new testConfig) {
+			if new.URL == "callback.example.com" {
+				panic("callback bug")
+			}
+		}),
+		fx.Populate(&dyn, &health),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	obs := panicObserver{failed: make(chan error, 10), panicked: make(chan error, 10)}
+	dyn.AddObserver(obs)
+
+	for _, tc := range []struct {
+		url, want, panic string
+		failed           bool
+	}{
+		{"callback.example.com", "callback.example.com", "callback bug", false},
+		{"validator.example.com", "callback.example.com", "validator bug", true},
+	} {
+		writeConfig(t, path, tc.url)
+
+		select {
+		case err := <-errs:
+			if !strings.Contains(err.Error(), tc.panic) {
+				t.Errorf("reported %v, want %q", err, tc.panic)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("panic %q was not reported", tc.panic)
+		}
+
+		if got := dyn.Load().URL; got != tc.want {
+			t.Errorf("Load().URL = %q, want %q", got, tc.want)
+		}
+
+		// A panicking callback doesn't fail the committed reload.
+		if err := health.Check(); (err != nil) != tc.failed {
+			t.Errorf("Check() = %v after a panic of %s", err, tc.url)
+		}
+
+		observed, other := obs.panicked, obs.failed
+		if tc.failed {
+			observed, other = other, observed
+		}
+
+		select {
+		case err := <-observed:
+			if !strings.Contains(err.Error(), tc.panic) {
+				t.Errorf("observed %v, want %q", err, tc.panic)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("panic %q was not observed", tc.panic)
+		}
+
+		if len(other) != 0 {
+			t.Errorf("panic %q observed as the wrong kind", tc.panic)
+		}
+	}
+
+	// The watcher survived the panics.
+	writeConfig(t, path, "second.example.com")
+	eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+}
+
+func TestNewPtr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var (
+		dyn config.Dynamic[testConfig]
+		ptr *testConfig
+	)
+
+	app := fxtest.New(t,
+		fx.Provide(fxconfig.NewPtr(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		)),
+		fx.Populate(&dyn, &ptr),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if ptr.URL != "first.example.com" {
+		t.Fatalf("URL = %q, want first.example.com", ptr.URL)
+	}
+
+	ptr.URL = "modified.example.com"
+	if got := dyn.Load().URL; got != "first.example.com" {
+		t.Errorf("Load().URL = %q after modifying the pointer", got)
+	}
+
+	writeConfig(t, path, "second.example.com")
+	eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+
+	if ptr.URL != "modified.example.com" {
+		t.Errorf("snapshot changed on reload to %q", ptr.URL)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	newE := func(data string, opts ...config.Option[testConfig]) (testConfig, error) {
+		opts = append([]config.Option[testConfig]{
+			config.WithConfigReader[testConfig](strings.NewReader(data), "yaml"),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.Optional[testConfig](),
+		}, opts...)
+
+		_, cfg, err := fxconfig.NewE(opts...)()
+
+		return cfg, err
+	}
+
+	t.Run("missing section", func(t *testing.T) {
+		cfg, err := newE("Other:\n  URL: other.example.com\n")
+		if err != nil || cfg != (testConfig{}) {
+			t.Fatalf("NewE() = %+v, %v, want zero value", cfg, err)
+		}
+	})
+
+	t.Run("missing section with default", func(t *testing.T) {
+		def := testConfig{URL: "default.example.com"}
+
+		cfg, err := newE("Other: {}\n", fxconfig.WithDefault(def))
+		if err != nil || cfg != def {
+			t.Fatalf("NewE() = %+v, %v, want %+v", cfg, err, def)
+		}
+	})
+
+	t.Run("present section", func(t *testing.T) {
+		cfg, err := newE("ServiceConfig:\n  URL: example.com\n")
+		if err != nil || cfg.URL != "example.com" {
+			t.Fatalf("NewE() = %+v, %v, want example.com", cfg, err)
+		}
+	})
+
+	t.Run("malformed section", func(t *testing.T) {
+		if _, err := newE("ServiceConfig: 5\n"); err == nil {
+			t.Fatal("NewE() succeeded with a malformed section")
+		}
+	})
+}
+
+func TestWithFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "file.example.com")
+
+	t.Setenv("APP_SERVICECONFIG_URL", "env.example.com")
+	t.Setenv("APP_SERVICECONFIG_TIMEOUT", "5s")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	opts := []config.Option[envConfig]{
+		config.WithConfigFile[envConfig](path),
+		config.WithSubSection[envConfig]("ServiceConfig"),
+		fxconfig.WithEnvPrefix[envConfig]("app"),
+		fxconfig.WithFlags[envConfig](fs, "ServiceConfig"),
+	}
+
+	for _, name := range []string{"serviceconfig.url", "serviceconfig.enabled", "serviceconfig.tls.certfile"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("flag -%s not registered", name)
+		}
+	}
+
+	if err := fs.Parse([]string{"-serviceconfig.url=flag.example.com", "-serviceconfig.enabled", "-serviceconfig.hosts=a,b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dyn *fxconfig.Dynamic[envConfig]
+
+	app := fxtest.New(t, fxconfig.Module(opts...), fx.Populate(&dyn))
+	app.RequireStart()
+	defer app.RequireStop()
+
+	got := dyn.Load()
+	if got.URL != "flag.example.com" || !got.Enabled || got.Timeout != 5*time.Second ||
+		!reflect.DeepEqual(got.Hosts, []string{"a", "b"}) || got.TLS != nil {
+		t.Fatalf("config = %+v", got)
+	}
+
+	// Flags are read at the initial load only, but keep their precedence on
+	// reloads.
+	if err := fs.Set("serviceconfig.url", "later.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, path, "second.example.com")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dyn.Load().URL; got != "flag.example.com" {
+		t.Fatalf("URL = %q, want flag.example.com", got)
+	}
+
+	if err := fs.Set("serviceconfig.timeout", "soon"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fxconfig.NewValue(opts...)(); err == nil || !strings.Contains(err.Error(), "-serviceconfig.timeout") {
+		t.Fatalf("err = %v, want invalid -serviceconfig.timeout", err)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if _, ok := fxconfig.FromContext[testConfig](context.Background()); ok {
+		t.Fatal("FromContext() found a config in an empty context")
+	}
+
+	ctx := fxconfig.NewContext(context.Background(), testConfig{URL: "example.com"})
+	ctx = fxconfig.NewContext(ctx, defaultConfig{})
+
+	if cfg, ok := fxconfig.FromContext[testConfig](ctx); !ok || cfg.URL != "example.com" {
+		t.Fatalf("FromContext() = %+v, %v", cfg, ok)
+	}
+}
+
+func TestNewFromFile(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing.yml")
+
+		app := fx.New(
+			fx.NopLogger,
+			fx.Provide(fxconfig.NewFromFile[testConfig](path)),
+			fx.Invoke(func(testConfig) {}),
+		)
+
+		if err := app.Err(); err == nil || !strings.Contains(err.Error(), path) {
+			t.Fatalf("err = %v, want error of %s", err, path)
+		}
+	})
+
+	t.Run("reloads", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		time.AfterFunc(50*time.Millisecond, func() { writeConfig(t, path, "first.example.com") })
+
+		var dyn config.Dynamic[testConfig]
+
+		app := fxtest.New(t,
+			fx.Provide(fxconfig.NewFromFile(path,
+				config.WithSubSection[testConfig]("ServiceConfig"),
+				fxconfig.WithRetry[testConfig](20, 10*time.Millisecond),
+			)),
+			fx.Populate(&dyn),
+		)
+		app.RequireStart()
+		defer app.RequireStop()
+
+		if got := dyn.Load().URL; got != "first.example.com" {
+			t.Fatalf("URL = %q, want first.example.com", got)
+		}
+
+		writeConfig(t, path, "second.example.com")
+		eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+	})
+}
+
+func TestConfigDescriptor(t *testing.T) {
+	type secretSection struct {
+		URL    string
+		Secret string `secret:"true"`
+	}
+
+	type params struct {
+		fx.In
+
+		Configs []fxconfig.ConfigDescriptor `group:"fxconfig"`
+	}
+
+	var p params
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigReader[testConfig](strings.NewReader("ServiceConfig:\n  URL: example.com\n"), "yaml"),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fxconfig.Static(secretSection{URL: "static.example.com", Secret: "s3cret"}),
+		fx.Populate(&p),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	got := make(map[string]any)
+	for _, desc := range p.Configs {
+		got[desc.TypeName] = desc.Snapshot()
+	}
+
+	want := map[string]any{
+		"fxconfig_test.testConfig":    map[string]any{"URL": "example.com"},
+		"fxconfig_test.secretSection": map[string]any{"URL": "static.example.com", "Secret": "***"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshots = %v, want %v", got, want)
+	}
+}
+
+func TestField(t *testing.T) {
+	type serviceURL string
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	var url config.Dynamic[serviceURL]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fxconfig.Field(func(c testConfig) serviceURL { return serviceURL(c.URL) }),
+		fx.Populate(&url),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if got := url.Load(); got != "first.example.com" {
+		t.Fatalf("Load() = %q, want first.example.com", got)
+	}
+
+	writeConfig(t, path, "second.example.com")
+	eventually(t, func() bool { return url.Load() == "second.example.com" })
+}
+
+// labelObserver records the config labels of reloads.
+type labelObserver struct {
+	labels chan string
+}
+
+func (o labelObserver) Reloaded(config string, _ uint64)    { o.labels <- config }
+func (o labelObserver) ReloadFailed(config string, _ error) { o.labels <- config }
+
+func TestWithName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	errs := make(chan error, 10)
+
+	var (
+		dyn    *fxconfig.Dynamic[testConfig]
+		health *fxconfig.Health[testConfig]
+		desc   fxconfig.ConfigDescriptor
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithName[testConfig]("primary"),
+			fxconfig.WithErrorSink[testConfig](func(err error) { errs <- err }),
+		),
+		fx.Invoke(fx.Annotate(func(d []fxconfig.ConfigDescriptor) { desc = d[0] }, fx.ParamTags(`group:"fxconfig"`))),
+		fx.Populate(&dyn, &health),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if dyn.Name() != "primary" || health.Name() != "primary" || desc.Name != "primary" {
+		t.Errorf("names = %q, %q, %q, want primary", dyn.Name(), health.Name(), desc.Name)
+	}
+
+	if desc.TypeName != "fxconfig_test.testConfig" {
+		t.Errorf("TypeName = %q", desc.TypeName)
+	}
+
+	obs := labelObserver{labels: make(chan string, 10)}
+	dyn.AddObserver(obs)
+
+	if err := os.WriteFile(path, []byte("ServiceConfig: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dyn.Reload(); err == nil {
+		t.Fatal("Reload of a corrupted config succeeded")
+	}
+
+	if label := <-obs.labels; label != "primary" {
+		t.Errorf("observed %q, want primary", label)
+	}
+
+	select {
+	case err := <-errs:
+		if !strings.HasPrefix(err.Error(), "primary: ") {
+			t.Errorf("reported %q, want prefix primary", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload error was not reported")
+	}
+}
+
+func TestWithVerifyWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	start := func(opts ...config.Option[testConfig]) error {
+		app := fx.New(
+			fx.NopLogger,
+			fxconfig.Module(append(opts, fxconfig.WithVerifyWatch[testConfig]())...),
+			fx.Invoke(func(testConfig) {}),
+		)
+		if err := app.Start(context.Background()); err != nil {
+			return err
+		}
+
+		return app.Stop(context.Background())
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []config.Option[testConfig]
+		err  string
+	}{
+		{"file", []config.Option[testConfig]{config.WithConfigFile[testConfig](path)}, ""},
+		{"static", []config.Option[testConfig]{
+			config.WithConfigReader[testConfig](strings.NewReader(""), "yaml"),
+			fxconfig.WithStatic[testConfig](),
+		}, ""},
+		{"reader", []config.Option[testConfig]{
+			config.WithConfigReader[testConfig](strings.NewReader(""), "yaml"),
+		}, "can't be watched"},
+		{"missing directory", []config.Option[testConfig]{
+			config.WithConfigFile[testConfig](filepath.Join(t.TempDir(), "missing", "config.yml")),
+		}, "failed to watch config"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := start(tc.opts...)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatal(err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+
+	t.Run("unmanaged", func(t *testing.T) {
+		_, _, err := fxconfig.NewE(
+			config.WithConfigReader[testConfig](strings.NewReader(""), "yaml"),
+			fxconfig.WithVerifyWatch[testConfig](),
+		)()
+		if err == nil || !strings.Contains(err.Error(), "WithVerifyWatch") {
+			t.Fatalf("NewE() = %v, want an error naming WithVerifyWatch", err)
+		}
+	})
+}
+
+func TestWithReloadSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first.example.com")
+
+	reloaded := make(chan uint64, 1)
+	unread := make(chan uint64)
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithReloadSignal[testConfig](reloaded),
+			fxconfig.WithReloadSignal[testConfig](unread),
+			// The writes settle, so no partially written config is signaled.
+			fxconfig.WithDebounce[testConfig](50*time.Millisecond),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	writeConfig(t, path, "second.example.com")
+
+	select {
+	case gen := <-reloaded:
+		if got := dyn.Load().URL; got != "second.example.com" || gen != dyn.Generation() {
+			t.Fatalf("signaled generation %d with %q, want %d with second.example.com", gen, got, dyn.Generation())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload was not signaled")
+	}
+}
+
+// TestConfigPackageFields fails if the loader of the config package lacks a
+// field fxconfig reads by reflection, see TestCheckLoader for the error
+// naming the field.
+func TestConfigPackageFields(t *testing.T) {
+	_, cfg, err := fxconfig.NewE(
+		config.WithConfigReader[testConfig](strings.NewReader("ServiceConfig:\n  URL: example.com\n"), "yaml"),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+		// The section is decoded by fxconfig, so it must be read correctly.
+		fxconfig.WithStrictKeys[testConfig](),
+	)()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.URL != "example.com" {
+		t.Fatalf("URL = %q, want example.com", cfg.URL)
+	}
+}
+
+func TestLoadNoCopy(t *testing.T) {
+	dyn, _, err := fxconfig.NewE(
+		config.WithConfigReader[testConfig](strings.NewReader("ServiceConfig:\n  URL: example.com\n"), "yaml"),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+	)()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A config without maps, slices or pointers is not copied.
+	if n := testing.AllocsPerRun(100, func() { dyn.Load() }); n != 0 {
+		t.Fatalf("Load() allocates %v times, want 0", n)
+	}
+}
+
+func TestLoadCopy(t *testing.T) {
+	type copyConfig struct {
+		Hosts  []string
+		Labels map[string]string
+		TLS    *struct{ CertFile string }
+	}
+
+	const data = `
+Service:
+  Hosts: [a, b]
+  Labels:
+    team: core
+  TLS:
+    CertFile: cert.pem
+`
+
+	dyn, _, err := fxconfig.NewE(
+		config.WithConfigReader[copyConfig](strings.NewReader(data), "yaml"),
+		config.WithSubSection[copyConfig]("Service"),
+	)()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := dyn.Load()
+	cfg.Hosts[0] = "mutated"
+	cfg.Labels["team"] = "mutated"
+	cfg.TLS.CertFile = "mutated"
+
+	got := dyn.Load()
+	if got.Hosts[0] != "a" || got.Labels["team"] != "core" || got.TLS.CertFile != "cert.pem" {
+		t.Fatalf("Load() = %+v after mutating a loaded config", got)
+	}
+}
+
+func TestWithPostProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "${HOST}")
+
+	t.Setenv("HOST", "first.example.com")
+
+	expand := func(c *testConfig) error {
+		if strings.Contains(c.URL, "invalid") {
+			return errors.New("invalid placeholder")
+		}
+
+		c.URL = os.ExpandEnv(c.URL)
+
+		return nil
+	}
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithPostProcess(expand),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if got := dyn.Load().URL; got != "first.example.com" {
+		t.Fatalf("URL = %q, want first.example.com", got)
+	}
+
+	t.Setenv("HOST", "second.example.com")
+	writeConfig(t, path, "https://${HOST}")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dyn.Load().URL; got != "https://second.example.com" {
+		t.Fatalf("URL = %q, want https://second.example.com", got)
+	}
+
+	writeConfig(t, path, "invalid")
+
+	if err := dyn.Reload(); err == nil || !strings.Contains(err.Error(), "invalid placeholder") {
+		t.Fatalf("Reload() = %v, want invalid placeholder", err)
+	}
+
+	if got := dyn.Load().URL; got != "https://second.example.com" {
+		t.Fatalf("URL = %q after a failed post-process", got)
+	}
+}
+
+// timeout is a duration type of its own, which the default decode hooks
+// don't decode from a string.
+type timeout time.Duration
+
+type hookConfig struct {
+	Timeout  timeout
+	Endpoint *url.URL
+	Retry    time.Duration
+}
+
+func TestWithDecodeHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("ServiceConfig:\n  Timeout: 1500ms\n  Endpoint: https://example.com/api\n  Retry: 2s\n")
+
+	toTimeout := func(from, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String || to != reflect.TypeFor[timeout]() {
+			return data, nil
+		}
+
+		d, err := time.ParseDuration(data.(string))
+
+		return timeout(d), err
+	}
+
+	var dyn *fxconfig.Dynamic[hookConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[hookConfig](path),
+			config.WithSubSection[hookConfig]("ServiceConfig"),
+			fxconfig.WithDecodeHook[hookConfig](toTimeout, mapstructure.StringToURLHookFunc()),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	cfg := dyn.Load()
+	if cfg.Timeout != timeout(1500*time.Millisecond) || cfg.Endpoint.Host != "example.com" || cfg.Retry != 2*time.Second {
+		t.Fatalf("initial config = %+v", cfg)
+	}
+
+	write("ServiceConfig:\n  Timeout: 3s\n  Endpoint: https://example.com/api\n  Retry: 2s\n")
+
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dyn.Load().Timeout; got != timeout(3*time.Second) {
+		t.Fatalf("Timeout after reload = %v, want 3s", time.Duration(got))
+	}
+
+	write("ServiceConfig:\n  Timeout: soon\n")
+
+	if err := dyn.Reload(); err == nil {
+		t.Fatal("reload of an invalid timeout succeeded")
+	}
+}
+
+type strictBase struct {
+	Region string
+}
+
+type strictConfig struct {
+	strictBase `mapstructure:",squash"`
+
+	URL string
+}
+
+func TestWithStrictKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := []config.Option[strictConfig]{
+		config.WithConfigFile[strictConfig](path),
+		config.WithSubSection[strictConfig]("ServiceConfig"),
+		fxconfig.WithStrictKeys[strictConfig](),
+	}
+
+	write("ServiceConfig:\n  Ur1: example.com\n")
+
+	if _, _, err := fxconfig.NewE(opts...)(); err == nil || !strings.Contains(err.Error(), "ur1") {
+		t.Fatalf("NewE() = %v, want an error naming the unknown key", err)
+	}
+
+	write("ServiceConfig:\n  URL: example.com\n  Region: eu\n")
+
+	var dyn *fxconfig.Dynamic[strictConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(opts...),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if cfg := dyn.Load(); cfg.URL != "example.com" || cfg.Region != "eu" {
+		t.Fatalf("config = %+v", cfg)
+	}
+
+	write("ServiceConfig:\n  URL: other.example.com\n  Regoin: us\n")
+
+	if err := dyn.Reload(); err == nil || !strings.Contains(err.Error(), "regoin") {
+		t.Fatalf("Reload() = %v, want an error naming the unknown key", err)
+	}
+
+	if got := dyn.Load().URL; got != "example.com" {
+		t.Fatalf("URL = %q after a rejected reload", got)
+	}
+}
+
+func TestReady(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, `""`)
+
+	ignore := goleak.IgnoreCurrent()
+
+	var dyn *fxconfig.Dynamic[testConfig]
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithDebounce[testConfig](50*time.Millisecond),
+		),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	err := dyn.Ready(ctx)
+	cancel()
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Ready() of the zero config = %v, want a deadline", err)
+	}
+
+	ready := make(chan error, 1)
+	go func() { ready <- dyn.Ready(context.Background()) }()
+
+	writeConfig(t, path, "pushed.example.com")
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Ready() was not woken by the reload")
+	}
+
+	if got := dyn.Load().URL; got != "pushed.example.com" {
+		t.Fatalf("URL = %q after Ready", got)
+	}
+
+	app.RequireStop()
+
+	eventually(t, func() bool { return goleak.Find(ignore) == nil })
+
+	t.Run("predicate", func(t *testing.T) {
+		dyn, _, err := fxconfig.NewE(
+			config.WithConfigReader[testConfig](strings.NewReader("ServiceConfig:\n  URL: example.com\n"), "yaml"),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithReadyPredicate(func(c testConfig) bool { return strings.HasPrefix(c.URL, "https://") }),
+		)()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := dyn.(*fxconfig.Dynamic[testConfig]).Ready(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Ready() = %v, want not ready", err)
+		}
+	})
+}
+
+type schemaTLS struct {
+	CertFile string `mapstructure:"cert_file"`
+}
+
+type schemaConfig struct {
+	strictBase `mapstructure:",squash"`
+
+	URL      string `mapstructure:"url"`
+	Port     uint16 `mapstructure:",omitempty"`
+	Timeout  time.Duration
+	Hosts    []string
+	Labels   map[string]int
+	TLS      *schemaTLS
+	Internal string         `mapstructure:"-"`
+	Extra    map[string]any `mapstructure:",remain"`
+}
+
+func TestSchema(t *testing.T) {
+	data, err := fxconfig.Schema[schemaConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Schema               string         `json:"$schema"`
+		Title                string         `json:"title"`
+		Type                 string         `json:"type"`
+		Required             []string       `json:"required"`
+		AdditionalProperties bool           `json:"additionalProperties"`
+		Properties           map[string]any `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+
+	if schema.Title != "fxconfig_test.schemaConfig" || schema.Type != "object" || !schema.AdditionalProperties {
+		t.Fatalf("schema = %s", data)
+	}
+
+	if want := []string{"Hosts", "Labels", "Region", "Timeout", "url"}; !reflect.DeepEqual(schema.Required, want) {
+		t.Errorf("required = %v, want %v", schema.Required, want)
+	}
+
+	want := map[string]any{
+		"url":     map[string]any{"type": "string"},
+		"Region":  map[string]any{"type": "string"},
+		"Port":    map[string]any{"type": "integer", "minimum": 0.0},
+		"Timeout": map[string]any{"type": []any{"string", "integer"}},
+		"Hosts":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"Labels":  map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "integer"}},
+		"TLS": map[string]any{
+			"type":       []any{"object", "null"},
+			"properties": map[string]any{"cert_file": map[string]any{"type": "string"}},
+			"required":   []any{"cert_file"},
+		},
+	}
+	if !reflect.DeepEqual(schema.Properties, want) {
+		t.Errorf("properties = %v, want %v", schema.Properties, want)
+	}
+
+	if _, err := fxconfig.Schema[struct{ Fn func() }](); err == nil {
+		t.Error("schema of a func field succeeded")
+	}
+}
+
+// urlNamer is implemented by testConfig.
+type urlNamer interface{ Name() string }
+
+func (c testConfig) Name() string { return c.URL }
+
+func TestProvider(t *testing.T) {
+	const data = "ServiceConfig:\n  URL: example.com\n"
+
+	var loads atomic.Int32
+
+	opts := func() []config.Option[testConfig] {
+		return []config.Option[testConfig]{
+			config.WithConfigReader[testConfig](strings.NewReader(data), "yaml"),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+			fxconfig.WithValidator(func(testConfig) error {
+				loads.Add(1)
+				return nil
+			}),
+		}
+	}
+
+	t.Run("roles", func(t *testing.T) {
+		type params struct {
+			fx.In
+
+			Dynamic config.Dynamic[testConfig]
+			Config  testConfig
+			Namer   urlNamer
+			Startup []testConfig `group:"startup-configs"`
+			Others  []testConfig `group:"others"`
+		}
+
+		var p params
+
+		app := fxtest.New(t,
+			fxconfig.NewProvider(opts()...).As(new(urlNamer)).InGroup("startup-configs").InGroup("others").Option(),
+			fx.Populate(&p),
+		)
+		app.RequireStart()
+		app.RequireStop()
+
+		if p.Dynamic.Load().URL != "example.com" || p.Config.URL != "example.com" || p.Namer.Name() != "example.com" ||
+			len(p.Startup) != 1 || len(p.Others) != 1 {
+			t.Fatalf("roles = %+v", p)
+		}
+
+		if n := loads.Swap(0); n != 1 {
+			t.Fatalf("config loaded %d times, want once", n)
+		}
+	})
+
+	t.Run("named", func(t *testing.T) {
+		type params struct {
+			fx.In
+
+			Dynamic config.Dynamic[testConfig] `name:"primary"`
+			Config  testConfig                 `name:"primary"`
+			Namer   urlNamer                   `name:"primary"`
+		}
+
+		var p params
+
+		app := fxtest.New(t,
+			fxconfig.NewProvider(opts()...).Named("primary").As(new(urlNamer)).Option(),
+			fx.Populate(&p),
+		)
+		app.RequireStart()
+		app.RequireStop()
+
+		if p.Dynamic.Load().URL != "example.com" || p.Config.URL != "example.com" || p.Namer.Name() != "example.com" {
+			t.Fatalf("roles = %+v", p)
+		}
+	})
+
+	t.Run("not implemented", func(t *testing.T) {
+		app := fx.New(
+			fx.NopLogger,
+			fxconfig.NewProvider(opts()...).As(new(fmt.Stringer)).Option(),
+		)
+		if err := app.Err(); err == nil || !strings.Contains(err.Error(), "fmt.Stringer") {
+			t.Fatalf("Err() = %v, want an unimplemented interface", err)
+		}
+	})
+}
+
+func TestNewEConcurrent(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "example.com")
+
+	const callers = 32
+
+	var loads, arrived atomic.Int32
+
+	newE := fxconfig.NewE(
+		config.WithConfigFile[testConfig](path),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+		fxconfig.WithValidator(func(testConfig) error {
+			// Keep the load running until all callers arrived.
+			if loads.Add(1) == 1 {
+				for arrived.Load() < callers {
+					time.Sleep(time.Millisecond)
+				}
+
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			return nil
+		}),
+	)
+
+	type result struct {
+		dyn config.Dynamic[testConfig]
+		cfg testConfig
+		err error
+	}
+
+	var (
+		wg      sync.WaitGroup
+		start   = make(chan struct{})
+		results = make([]result, callers)
+	)
+
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			arrived.Add(1)
+			dyn, cfg, err := newE()
+			results[i] = result{dyn, cfg, err}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("config loaded %d times, want once", n)
+	}
+
+	for i, r := range results {
+		if r.err != nil {
+			t.Fatalf("call %d: %v", i, r.err)
+		}
+
+		if r.dyn != results[0].dyn || r.cfg != results[0].cfg || r.cfg.URL != "example.com" {
+			t.Fatalf("call %d returned %p, %+v, want %p, %+v", i, r.dyn, r.cfg, results[0].dyn, results[0].cfg)
+		}
+	}
+
+	results[0].dyn.(*fxconfig.Dynamic[testConfig]).Close()
+}
+
+func TestNewETwoApps(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+
+	newE := fxconfig.NewE(
+		config.WithConfigFile[testConfig](path),
+		config.WithSubSection[testConfig]("ServiceConfig"),
+	)
+
+	app := fx.New(fx.NopLogger, fx.Provide(newE), fx.Invoke(func(testConfig) {}))
+	if app.Err() == nil {
+		t.Fatal("fx.New() succeeded without a config file")
+	}
+
+	writeConfig(t, path, "first.example.com")
+
+	var dyns [2]*fxconfig.Dynamic[testConfig]
+
+	for i := range dyns {
+		app := fxtest.New(t, fx.Provide(newE), fx.Invoke(func(dyn config.Dynamic[testConfig]) {
+			dyns[i] = dyn.(*fxconfig.Dynamic[testConfig])
+		}))
+		app.RequireStart()
+		app.RequireStop()
+	}
+
+	if dyns[0] == dyns[1] {
+		t.Fatal("both apps got the same Dynamic Config")
+	}
+
+	// The watchers run after the apps stopped, until the configs are closed.
+	writeConfig(t, path, "second.example.com")
+
+	for _, dyn := range dyns {
+		eventually(t, func() bool { return dyn.Load().URL == "second.example.com" })
+		dyn.Close()
+	}
+}
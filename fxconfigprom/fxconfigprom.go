@@ -0,0 +1,177 @@
+// Package fxconfigprom exports the reloads of fxconfig as Prometheus
+// metrics. It is a separate module, so only apps using it depend on the
+// Prometheus client.
+//
+// Provide the Collector by Module, observe each config type by Observe and
+// register the Collector with a registry:
+//
+//	fx.New(
+//		fxconfig.Module[ServiceConfig](opts...),
+//		fxconfigprom.Module(),
+//		fxconfigprom.Observe[ServiceConfig](),
+//		fx.Invoke(func(c *fxconfigprom.Collector) { prometheus.MustRegister(c) }),
+//	)
+package fxconfigprom
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+)
+
+// Collector is a prometheus.Collector of the reloads of the observed configs.
+// All metrics are labeled by the config type, or the name set by
+// fxconfig.WithName:
+//
+//	fxconfig_reloads_total{config="main.ServiceConfig"}         successful reloads
+//	fxconfig_reload_failures_total{config="main.ServiceConfig"} failed reloads
+//	fxconfig_callback_panics_total{config="main.ServiceConfig"} panics of reload callbacks
+//	fxconfig_generation{config="main.ServiceConfig"}            current generation
+//
+// The prefix "fxconfig" can be changed by WithPrefix.
+type Collector struct {
+	reloads    *prometheus.CounterVec
+	failures   *prometheus.CounterVec
+	panics     *prometheus.CounterVec
+	generation *prometheus.Desc
+
+	mu          sync.Mutex
+	generations map[string]func() uint64
+}
+
+// Ensure Collector implements prometheus.Collector, fxconfig.ReloadObserver
+// and fxconfig.CallbackObserver
+var (
+	_ prometheus.Collector      = (*Collector)(nil)
+	_ fxconfig.ReloadObserver   = (*Collector)(nil)
+	_ fxconfig.CallbackObserver = (*Collector)(nil)
+)
+
+// Option is an option of New.
+type Option func(*options)
+
+type options struct {
+	prefix string
+}
+
+// WithPrefix is an option to set the prefix of the metric names, "fxconfig"
+// by default.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// New returns a Collector without observed configs.
+func New(opts ...Option) *Collector {
+	o := options{prefix: "fxconfig"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Collector{
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: o.prefix + "_reloads_total",
+			Help: "Number of successful config reloads.",
+		}, []string{"config"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: o.prefix + "_reload_failures_total",
+			Help: "Number of failed config reloads.",
+		}, []string{"config"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: o.prefix + "_callback_panics_total",
+			Help: "Number of panics of config reload callbacks.",
+		}, []string{"config"}),
+		generation: prometheus.NewDesc(
+			o.prefix+"_generation",
+			"Generation of the current config.",
+			[]string{"config"}, nil,
+		),
+		generations: make(map[string]func() uint64),
+	}
+}
+
+// Module returns an fx.Option which provides the Collector of New.
+func Module(opts ...Option) fx.Option {
+	return fx.Provide(func() *Collector { return New(opts...) })
+}
+
+// Observe returns an fx.Option which adds the Dynamic Config of T to the
+// Collector.
+func Observe[T any]() fx.Option {
+	return fx.Invoke(func(c *Collector, dyn config.Dynamic[T]) error {
+		d, ok := dyn.(*fxconfig.Dynamic[T])
+		if !ok {
+			return fmt.Errorf("fxconfigprom: %T is not provided by fxconfig", dyn)
+		}
+
+		ObserveDynamic(c, d)
+
+		return nil
+	})
+}
+
+// ObserveDynamic adds d to c, for Dynamic Configs not wired by fx.
+func ObserveDynamic[T any](c *Collector, d *fxconfig.Dynamic[T]) {
+	name := d.Name()
+
+	c.mu.Lock()
+	c.generations[name] = d.Generation
+	c.mu.Unlock()
+
+	// Export the counters of name before its first reload.
+	c.reloads.WithLabelValues(name)
+	c.failures.WithLabelValues(name)
+	c.panics.WithLabelValues(name)
+
+	d.AddObserver(c)
+}
+
+// Reloaded counts a successful reload of config.
+func (c *Collector) Reloaded(config string, _ uint64) {
+	c.reloads.WithLabelValues(config).Inc()
+}
+
+// ReloadFailed counts a failed reload of config.
+func (c *Collector) ReloadFailed(config string, _ error) {
+	c.failures.WithLabelValues(config).Inc()
+}
+
+// CallbackPanicked counts a panic of a reload callback of config.
+func (c *Collector) CallbackPanicked(config string, _ error) {
+	c.panics.WithLabelValues(config).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.reloads.Describe(ch)
+	c.failures.Describe(ch)
+	c.panics.Describe(ch)
+	ch <- c.generation
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.reloads.Collect(ch)
+	c.failures.Collect(ch)
+	c.panics.Collect(ch)
+
+	c.mu.Lock()
+	names := make([]string, 0, len(c.generations))
+	for name := range c.generations {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		gen := c.generations[name]()
+		ch <- prometheus.MustNewConstMetric(c.generation, prometheus.GaugeValue, float64(gen), name)
+	}
+	c.mu.Unlock()
+}
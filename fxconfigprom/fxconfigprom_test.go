@@ -0,0 +1,89 @@
+package fxconfigprom_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+	"schneider.vip/fxconfig/fxconfigprom"
+)
+
+type testConfig struct {
+	URL string
+}
+
+func TestCollector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("ServiceConfig:\n  URL: first.example.com\n")
+
+	var (
+		dyn *fxconfig.Dynamic[testConfig]
+		c   *fxconfigprom.Collector
+	)
+
+	app := fxtest.New(t,
+		fxconfig.Module(
+			config.WithConfigFile[testConfig](path),
+			config.WithSubSection[testConfig]("ServiceConfig"),
+		),
+		fxconfigprom.Module(fxconfigprom.WithPrefix("test")),
+		fxconfigprom.Observe[testConfig](),
+		fxconfig.OnReload(func(_, new testConfig) {
+			if new.URL == "second.example.com" {
+				panic("callback bug")
+			}
+		}),
+		fx.Populate(&dyn, &c),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+
+	write("ServiceConfig:\n  URL: second.example.com\n")
+	if err := dyn.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	write("ServiceConfig: [")
+	if err := dyn.Reload(); err == nil {
+		t.Fatal("Reload of a corrupted config succeeded")
+	}
+
+	// The watcher might reload as well, so compare the generation only.
+	want := `
+# HELP test_generation Generation of the current config.
+# TYPE test_generation gauge
+test_generation{config="fxconfigprom_test.testConfig"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "test_generation"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(c, "test_reloads_total", "test_reload_failures_total", "test_callback_panics_total"); n != 3 {
+		t.Fatalf("%d metrics, want 3", n)
+	}
+
+	want = `
+# HELP test_callback_panics_total Number of panics of config reload callbacks.
+# TYPE test_callback_panics_total counter
+test_callback_panics_total{config="fxconfigprom_test.testConfig"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "test_callback_panics_total"); err != nil {
+		t.Fatal(err)
+	}
+}
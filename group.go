@@ -0,0 +1,245 @@
+package fxconfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// GroupSource reads the config source of a group into the viper instance
+// shared by its sections.
+type GroupSource func(v *viper.Viper) error
+
+// GroupFile returns a GroupSource which reads the config file path. The file
+// is watched and all sections are reloaded when it changes.
+func GroupFile(path string) GroupSource {
+	return func(v *viper.Viper) error {
+		v.SetConfigFile(path)
+		return v.ReadInConfig()
+	}
+}
+
+// GroupReader returns a GroupSource which reads the config of configType,
+// e.g. "yaml", from r.
+func GroupReader(r io.Reader, configType string) GroupSource {
+	return func(v *viper.Viper) error {
+		v.SetConfigType(configType)
+		return v.ReadConfig(r)
+	}
+}
+
+// GroupSection is a section of a group, see Section.
+type GroupSection interface {
+	load(g *group) (member, error)
+	provide(i int) fx.Option
+}
+
+// Section returns a GroupSection, which decodes the sub section name of the
+// group's source into T. Of opts only the fxconfig options apply, e.g.
+// WithValidator or WithDefault; the source comes from the group.
+func Section[T any](name string, opts ...config.Option[T]) GroupSection {
+	return section[T]{name: name, opts: opts}
+}
+
+type section[T any] struct {
+	name string
+	opts []config.Option[T]
+}
+
+func (s section[T]) load(g *group) (member, error) {
+	o, err := collectOptions(s.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dynamic[T]{
+		viper:   g.viper,
+		section: s.name,
+		opts:    o,
+		group:   g,
+	}
+
+	value, err := d.decode()
+	if err == nil {
+		value, err = d.override(value)
+	}
+
+	if err == nil {
+		value, err = o.postProcess(value)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("fxconfig: failed to load section %q: %w", s.name, err)
+	}
+
+	if err := o.validate(value); err != nil {
+		return nil, fmt.Errorf("fxconfig: invalid section %q: %w", s.name, err)
+	}
+
+	d.current.Store(&snapshot[T]{value: value, generation: 1})
+	d.loaded()
+
+	return d, nil
+}
+
+func (s section[T]) provide(i int) fx.Option {
+	return fx.Options(
+		fx.Provide(func(g *group) (config.Dynamic[T], T, Loader[T], *Dynamic[T], *Health[T], *Status[T]) {
+			d := g.members[i].(*Dynamic[T])
+			return d, d.Load(), d, d, &Health[T]{d: d}, &Status[T]{d: d}
+		}),
+		WithDescriptor[T](),
+	)
+}
+
+// member is a section of a group.
+type member interface {
+	commit(readErr error) error
+	watch(ctx context.Context)
+	startErrorSink()
+	setShutdowner(sd fx.Shutdowner)
+	verifyWatch(lc fx.Lifecycle)
+	startupHook(lc fx.Lifecycle)
+	Close() error
+}
+
+// commit parses the config freshly read by the group.
+func (d *Dynamic[T]) commit(readErr error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.update(nil, readErr)
+}
+
+// group is the shared source of several sections.
+type group struct {
+	viper   *viper.Viper
+	mu      sync.Mutex // serializes reloads and guards viper
+	members []member
+	pending []pendingFunc // of afterCommit, called when the reload committed
+}
+
+// pendingFunc is a func registered by afterCommit.
+type pendingFunc struct {
+	key any
+	fn  func()
+}
+
+// NewGroup returns an fx.Option which reads src once and provides each of
+// sections like Module does: config.Dynamic[T], T, Loader[T], *Dynamic[T],
+// *Health[T], *Status[T] and the ConfigDescriptor of its type. So a group
+// needs distinct types for its sections.
+// A single watcher reloads all sections when the file of src changes, the
+// watch options such as WithDebounce of the first section apply to it.
+// Consumers inject the sections by their types:
+//
+//	fxconfig.NewGroup(fxconfig.GroupFile("config.yml"),
+//		fxconfig.Section[DBConfig]("DB"),
+//		fxconfig.Section[CacheConfig]("Cache"),
+//	),
+//	fx.Invoke(func(db DBConfig, cache config.Dynamic[CacheConfig]) { ... }),
+func NewGroup(src GroupSource, sections ...GroupSection) fx.Option {
+	newGroup := func(lc fx.Lifecycle, sd fx.Shutdowner) (*group, error) {
+		g := &group{viper: viper.NewWithOptions(viper.KeyDelimiter("_"))}
+		g.viper.AutomaticEnv()
+
+		if err := src(g.viper); err != nil {
+			return nil, fmt.Errorf("fxconfig: failed to read config: %w", err)
+		}
+
+		for _, s := range sections {
+			m, err := s.load(g)
+			if err != nil {
+				return nil, err
+			}
+
+			g.members = append(g.members, m)
+		}
+
+		for _, m := range g.members {
+			m.setShutdowner(sd)
+			m.startupHook(lc)
+		}
+
+		lc.Append(fx.StartStopHook(g.start, g.close))
+
+		if len(g.members) > 0 {
+			g.members[0].verifyWatch(lc)
+		}
+
+		return g, nil
+	}
+
+	opts := []fx.Option{fx.Provide(newGroup, fx.Private)}
+	for i, s := range sections {
+		opts = append(opts, s.provide(i))
+	}
+
+	return fx.Module("fxconfig.group", opts...)
+}
+
+// reload reads the source again and commits all sections. It returns the
+// error of the section self.
+func (g *group) reload(self member) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var readErr error
+	if g.viper.ConfigFileUsed() != "" {
+		readErr = g.viper.ReadInConfig()
+	}
+
+	var err error
+
+	for _, m := range g.members {
+		if merr := m.commit(readErr); m == self {
+			err = merr
+		}
+	}
+
+	pending := g.pending
+	g.pending = nil
+
+	for _, p := range pending {
+		p.fn()
+	}
+
+	return err
+}
+
+// afterCommit registers fn to be called when the running reload committed
+// all sections. A fn of a key registered already is not called again. It
+// must be called with g.mu held, i.e. by a reload callback of a section.
+func (g *group) afterCommit(key any, fn func()) {
+	for _, p := range g.pending {
+		if p.key == key {
+			return
+		}
+	}
+
+	g.pending = append(g.pending, pendingFunc{key, fn})
+}
+
+// start starts the watcher of the group by its first section and the error
+// sinks of the others.
+func (g *group) start() {
+	for i, m := range g.members {
+		if i == 0 {
+			m.watch(context.Background())
+		} else {
+			m.startErrorSink()
+		}
+	}
+}
+
+// close stops the watcher and the error sinks of the group.
+func (g *group) close() {
+	for _, m := range g.members {
+		m.Close()
+	}
+}
@@ -0,0 +1,184 @@
+package fxconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/goleak"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+)
+
+type dbConfig struct {
+	DSN string
+}
+
+type cacheConfig struct {
+	Size int
+}
+
+func TestNewGroup(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(dsn, size string) {
+		data := "DB:\n  DSN: " + dsn + "\nCache:\n  Size: " + size + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first", "1")
+
+	var (
+		db    config.Dynamic[dbConfig]
+		cache *fxconfig.Dynamic[cacheConfig]
+	)
+
+	app := fxtest.New(t,
+		fxconfig.NewGroup(fxconfig.GroupFile(path),
+			fxconfig.Section[dbConfig]("DB"),
+			fxconfig.Section[cacheConfig]("Cache"),
+		),
+		fx.Populate(&db, &cache),
+	)
+	app.RequireStart()
+
+	if got := db.Load().DSN; got != "first" {
+		t.Fatalf("DSN = %q, want first", got)
+	}
+
+	if got := cache.Load().Size; got != 1 {
+		t.Fatalf("Size = %d, want 1", got)
+	}
+
+	write("second", "2")
+	eventually(t, func() bool { return db.Load().DSN == "second" && cache.Load().Size == 2 })
+
+	app.RequireStop()
+}
+
+func TestNewGroupMissingSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("DB:\n  DSN: first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fx.New(
+		fx.NopLogger,
+		fxconfig.NewGroup(fxconfig.GroupFile(path),
+			fxconfig.Section[dbConfig]("DB"),
+			fxconfig.Section[cacheConfig]("Cache"),
+		),
+		fx.Invoke(func(dbConfig) {}),
+	)
+
+	if app.Err() == nil {
+		t.Fatal("missing section did not fail the app")
+	}
+}
+
+type serverConfig struct {
+	DSN  string
+	Size int
+	URL  string
+}
+
+func TestCombine3(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(dsn, size string) {
+		data := "DB:\n  DSN: " + dsn + "\nCache:\n  Size: " + size + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first", "1")
+
+	var (
+		server config.Dynamic[serverConfig]
+		cfg    serverConfig
+	)
+
+	app := fxtest.New(t,
+		fxconfig.NewGroup(fxconfig.GroupFile(path),
+			fxconfig.Section[dbConfig]("DB"),
+			fxconfig.Section[cacheConfig]("Cache"),
+		),
+		fxconfig.Static(testConfig{URL: "example.com"}),
+		fxconfig.Combine3(func(db dbConfig, cache cacheConfig, svc testConfig) serverConfig {
+			return serverConfig{DSN: db.DSN, Size: cache.Size, URL: svc.URL}
+		}),
+		fx.Populate(&server, &cfg),
+	)
+	app.RequireStart()
+
+	if want := (serverConfig{DSN: "first", Size: 1, URL: "example.com"}); cfg != want || server.Load() != want {
+		t.Fatalf("combined config = %+v, want %+v", server.Load(), want)
+	}
+
+	write("second", "2")
+	eventually(t, func() bool { return server.Load() == serverConfig{DSN: "second", Size: 2, URL: "example.com"} })
+
+	app.RequireStop()
+}
+
+func TestCombine2Group(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	// write replaces the file atomically, so the watcher never reloads a
+	// partially written config.
+	write := func(dsn, size string) {
+		data := "DB:\n  DSN: " + dsn + "\nCache:\n  Size: " + size + "\n"
+		if err := os.WriteFile(path+".tmp", []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first", "1")
+
+	var (
+		db     *fxconfig.Dynamic[dbConfig]
+		server config.Dynamic[serverConfig]
+	)
+
+	combined := make(chan serverConfig, 10)
+
+	app := fxtest.New(t,
+		fxconfig.NewGroup(fxconfig.GroupFile(path),
+			fxconfig.Section[dbConfig]("DB"),
+			fxconfig.Section[cacheConfig]("Cache"),
+		),
+		fxconfig.Combine2(func(db dbConfig, cache cacheConfig) serverConfig {
+			return serverConfig{DSN: db.DSN, Size: cache.Size}
+		}),
+		fxconfig.OnReload(func(_, new serverConfig) { combined <- new }),
+		fx.Populate(&db, &server),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	write("second", "2")
+
+	if err := db.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both sections changed by one reload of the group, which combines them
+	// once: no combined config pairs the new DB with the old cache.
+	if got, want := <-combined, (serverConfig{DSN: "second", Size: 2}); got != want {
+		t.Fatalf("combined config = %+v, want %+v", got, want)
+	}
+
+	if got := server.Load(); got != (serverConfig{DSN: "second", Size: 2}) {
+		t.Fatalf("Load() = %+v", got)
+	}
+}
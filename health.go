@@ -0,0 +1,109 @@
+package fxconfig
+
+import (
+	"fmt"
+	"time"
+
+	"schneider.vip/config"
+)
+
+// Health reports the freshness of the Dynamic Config of T, e.g. for a
+// readiness probe. It is provided by Module, with other constructors use
+// fx.Provide(fxconfig.NewHealth[T]). It is safe for concurrent use.
+type Health[T any] struct {
+	d *Dynamic[T]
+}
+
+// health is the state of the last load or reload and of the watcher.
+type health struct {
+	loaded     time.Time // of the last successful load or reload
+	err        error     // of the last reload, if it failed
+	generation uint64    // of the committed config
+	watching   bool      // whether the watcher is running
+	source     string    // of the committed config
+}
+
+// NewHealth returns the Health of the Dynamic Config dyn.
+func NewHealth[T any](dyn config.Dynamic[T]) (*Health[T], error) {
+	d, err := asDynamic(dyn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Health[T]{d: d}, nil
+}
+
+// Name returns the name of the config type, e.g. "main.ServiceConfig", or
+// the name set by WithName, to tell the configs of an app apart.
+func (h *Health[T]) Name() string {
+	return h.d.opts.label()
+}
+
+// LastReload returns the time of the last successful load or reload, also
+// if it didn't change the config.
+func (h *Health[T]) LastReload() time.Time {
+	return h.state().loaded
+}
+
+// LastError returns the error of the last reload, or nil if it succeeded.
+func (h *Health[T]) LastError() error {
+	return h.state().err
+}
+
+// Check returns an error naming the config type if the last reload failed.
+// The config in use is the last successfully loaded one then, see
+// LastReload.
+func (h *Health[T]) Check() error {
+	if err := h.state().err; err != nil {
+		return fmt.Errorf("fxconfig: %s: last reload failed: %w", h.Name(), err)
+	}
+
+	return nil
+}
+
+func (h *Health[T]) state() health {
+	return h.d.state()
+}
+
+// state returns the latest health of d.
+func (d *Dynamic[T]) state() health {
+	if s := d.health.Load(); s != nil {
+		return *s
+	}
+
+	return health{}
+}
+
+// setHealth updates the health of d by fn. The watcher updates it
+// concurrently to the reloads, so a copy is updated and swapped in.
+func (d *Dynamic[T]) setHealth(fn func(*health)) {
+	for {
+		last := d.health.Load()
+
+		next := &health{}
+		if last != nil {
+			*next = *last
+		}
+
+		fn(next)
+
+		if d.health.CompareAndSwap(last, next) {
+			return
+		}
+	}
+}
+
+// loaded records a successful load or reload of the committed config.
+func (d *Dynamic[T]) loaded() {
+	generation, source := d.current.Load().generation, d.source()
+
+	d.setHealth(func(h *health) {
+		h.loaded, h.err = time.Now(), nil
+		h.generation, h.source = generation, source
+	})
+}
+
+// reloadFailed records a failed reload.
+func (d *Dynamic[T]) reloadFailed(err error) {
+	d.setHealth(func(h *health) { h.err = err })
+}
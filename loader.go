@@ -0,0 +1,168 @@
+package fxconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+	"schneider.vip/config"
+)
+
+// newLoader creates the loader of the config package with opts on the viper
+// instance v, and collects the fxconfig options of opts in o. It returns the
+// raw bytes of the config file, if the config is read from a file.
+func newLoader[T any](v *viper.Viper, o *options[T], opts []config.Option[T]) (l config.Loader[T], raw []byte, err error) {
+	// Register o for the loader, so the fxconfig options find it.
+	var addr uintptr
+	track := loaderOption[T](func(l reflect.Value) {
+		addr = l.Pointer()
+		building.Store(addr, o)
+
+		if err := checkLoader(l); err != nil {
+			o.fail(err)
+		}
+	})
+
+	finish := loaderOption[T](func(l reflect.Value) {
+		// Read the default file like config.New does, but before the
+		// initial parse, so the raw bytes are read as well.
+		if !loaderReadsSource(l) {
+			reflect.ValueOf(config.WithConfigFile[T]("config.yml")).Call([]reflect.Value{l})
+		}
+
+		// The file is read again, so the initial parse uses exactly the
+		// raw bytes. If that fails, the error was logged by the config
+		// package already.
+		if file := v.ConfigFileUsed(); file != "" {
+			var err error
+			if raw, err = readFile(v); err != nil && o.requireFile {
+				o.fail(fmt.Errorf("fxconfig: failed to read config file %s: %w", file, err))
+			}
+		}
+
+		// If fxconfig decodes the config itself, the initial parse of
+		// config.New is skipped, it might fail where fxconfig succeeds.
+		if o.decodes() {
+			reflect.ValueOf(config.DisableAutoParse[T]()).Call([]reflect.Value{l})
+		}
+	})
+
+	defer func() {
+		building.Delete(addr)
+
+		// config.New panics if the initial parse fails. The error of an
+		// invalid option is the cause.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("fxconfig: %v", r)
+		}
+
+		if o.err != nil {
+			l, raw, err = nil, nil, o.err
+		}
+	}()
+
+	opts = append([]config.Option[T]{config.WithViperInstance[T](v), track}, opts...)
+
+	return config.New(append(opts, finish)...), raw, nil
+}
+
+// readFile reads the config file of v into v and returns its raw bytes.
+func readFile(v *viper.Viper) ([]byte, error) {
+	raw, err := os.ReadFile(v.ConfigFileUsed())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.ReadConfig(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+// loaderOption returns a config.Option which calls fn with the loader. The
+// argument of config.Option is unexported by the config package, so the
+// func is made by reflection.
+func loaderOption[T any](fn func(l reflect.Value)) config.Option[T] {
+	typ := reflect.TypeFor[config.Option[T]]()
+
+	return reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		fn(args[0])
+		return nil
+	}).Interface().(config.Option[T])
+}
+
+// loaderFields are the unexported fields of the loader of the config package
+// read by reflection, with their kinds.
+var loaderFields = []struct {
+	name string
+	kind reflect.Kind
+}{
+	{"subSection", reflect.String},
+	{"useDefaultFilename", reflect.Bool},
+}
+
+// checkLoader returns an error if the loader l lacks one of loaderFields,
+// e.g. because a release of the config package renamed it. Without them the
+// config would be misread silently, so the constructors fail instead.
+func checkLoader(l reflect.Value) error {
+	typ := l.Type().Elem()
+
+	for _, field := range loaderFields {
+		if f, ok := typ.FieldByName(field.name); !ok || f.Type.Kind() != field.kind {
+			return fmt.Errorf("fxconfig: unsupported version of schneider.vip/config: %s has no %s field %s",
+				typ, field.kind, field.name)
+		}
+	}
+
+	return nil
+}
+
+// loaderSection returns the sub section set by config.WithSubSection. The
+// config package doesn't export it, so it is read by reflection, see
+// checkLoader.
+func loaderSection[T any](l config.Loader[T]) string {
+	field := reflect.ValueOf(l).Elem().FieldByName("subSection")
+	if field.Kind() != reflect.String {
+		return ""
+	}
+
+	return field.String()
+}
+
+// collectOptions collects the fxconfig options of opts without a source of
+// the config package: opts are applied to a loader which reads an empty
+// config and is discarded afterwards.
+func collectOptions[T any](opts []config.Option[T]) (*options[T], error) {
+	o := &options[T]{}
+	v := viper.NewWithOptions(viper.KeyDelimiter("_"))
+
+	opts = append([]config.Option[T]{
+		config.WithLogger[T](nopLogger{}),
+		config.WithConfigReader[T](strings.NewReader(""), "yaml"),
+	}, opts...)
+
+	if _, _, err := newLoader(v, o, append(opts, config.DisableAutoParse[T]())); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// nopLogger is a config.Logger which discards all messages.
+type nopLogger struct{}
+
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
+
+// loaderReadsSource reports whether a source was set on the loader l, e.g.
+// by config.WithConfigFile or config.WithConfigReader. Otherwise config.New
+// reads the default file "config.yml" after applying the options. The config
+// package doesn't export it, so it is read by reflection, see checkLoader.
+func loaderReadsSource(l reflect.Value) bool {
+	field := l.Elem().FieldByName("useDefaultFilename")
+	return field.Kind() == reflect.Bool && !field.Bool()
+}
@@ -0,0 +1,39 @@
+package fxconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckLoader(t *testing.T) {
+	for name, tc := range map[string]struct {
+		loader any
+		field  string
+	}{
+		"no subSection": {&struct {
+			useDefaultFilename bool
+		}{}, "subSection"},
+		"no useDefaultFilename": {&struct {
+			subSection string
+		}{}, "useDefaultFilename"},
+		"wrong kind": {&struct {
+			subSection         string
+			useDefaultFilename string
+		}{}, "useDefaultFilename"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := checkLoader(reflect.ValueOf(tc.loader))
+			if err == nil || !strings.HasSuffix(err.Error(), " field "+tc.field) {
+				t.Fatalf("checkLoader() = %v, want an error naming %s", err, tc.field)
+			}
+		})
+	}
+
+	if err := checkLoader(reflect.ValueOf(&struct {
+		subSection         string
+		useDefaultFilename bool
+	}{})); err != nil {
+		t.Fatalf("checkLoader() = %v for a loader with all fields", err)
+	}
+}
@@ -0,0 +1,91 @@
+package fxconfig
+
+import (
+	"fmt"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// Map returns an fx.Option which provides a config.Dynamic[U] and U derived
+// from the Dynamic Config of T by fn, e.g. a parsed *url.URL instead of a
+// string. U is derived again whenever a reload changes T. An error of fn
+// fails the app on the initial load; on a reload it is handled by the
+// reload failure policy of T, see WithReloadFailurePolicy, and the last U is
+// kept.
+//
+//	fxconfig.Map(func(c ServiceConfig) (*url.URL, error) { return url.Parse(c.URL) })
+func Map[T, U any](fn func(T) (U, error)) fx.Option {
+	return fx.Provide(func(dyn config.Dynamic[T]) (config.Dynamic[U], U, error) {
+		src, err := asDynamic(dyn)
+		if err != nil {
+			var zero U
+			return nil, zero, err
+		}
+
+		d, err := mapDynamic(src, fn)
+		if err != nil {
+			var zero U
+			return nil, zero, err
+		}
+
+		return d, d.Load(), nil
+	})
+}
+
+// Field returns an fx.Option which provides a config.Dynamic[F] of a single
+// field of the config of T, for consumers which need that field only. It is
+// Map without an error: the field is extracted again whenever a reload
+// changes T. Unlike Map, F itself is not provided, as fields are often of
+// common types like string. F identifies the Dynamic Config in the graph, so
+// a named type keeps fields apart:
+//
+//	type ServiceURL string
+//
+//	fxconfig.Field(func(c ServiceConfig) ServiceURL { return ServiceURL(c.URL) })
+func Field[T, F any](extract func(T) F) fx.Option {
+	return fx.Provide(func(dyn config.Dynamic[T]) (config.Dynamic[F], error) {
+		src, err := asDynamic(dyn)
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := mapDynamic(src, func(cfg T) (F, error) { return extract(cfg), nil })
+		if err != nil {
+			return nil, err
+		}
+
+		return d, nil
+	})
+}
+
+// mapDynamic returns the Dynamic Config derived from src by fn.
+func mapDynamic[T, U any](src *Dynamic[T], fn func(T) (U, error)) (*Dynamic[U], error) {
+	derive := func() (U, error) {
+		u, err := fn(src.Load())
+		if err != nil {
+			return u, fmt.Errorf("failed to map %s to %s: %w", typeName[T](), typeName[U](), err)
+		}
+
+		return u, nil
+	}
+
+	d := &Dynamic[U]{
+		opts:       &options[U]{failurePolicy: src.opts.failurePolicy},
+		derive:     derive,
+		shutdowner: src.shutdowner,
+	}
+
+	value, err := derive()
+	if err != nil {
+		return nil, fmt.Errorf("fxconfig: %w", err)
+	}
+
+	if err := d.init(value, nil); err != nil {
+		return nil, err
+	}
+
+	src.onReload(func(_, _ T) { d.Reload() })
+
+	return d, nil
+}
@@ -0,0 +1,236 @@
+package fxconfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// NewMerged returns an constructor like NewManaged, which merges the config
+// from several sources. Options which set a source, i.e.
+// config.WithConfigFile, config.WithConfigReader and config.WithConfigPath,
+// are read separately and merged in their order; all other options apply to
+// the merged config. config.WithConfigPath reads the first file named
+// "config" with a supported extension in its paths:
+//
+//	fxconfig.NewMerged(
+//		config.WithConfigFile[ServiceConfig]("base.yml"),
+//		config.WithConfigFile[ServiceConfig]("production.yml"),
+//		config.WithConfigFile[ServiceConfig]("secrets.yml"),
+//		config.WithSubSection[ServiceConfig]("ServiceConfig"),
+//	)
+//
+// Later sources win on conflicts. Maps, and so nested structs and pointers
+// to structs, are merged key-wise: a later source overrides only the keys it
+// sets. Scalars and slices are replaced as a whole. A change of any source
+// file reloads and merges all sources again. A source which can't be read
+// fails the constructor.
+func NewMerged[T any](sources ...config.Option[T]) func(fx.Lifecycle, fx.Shutdowner) (config.Dynamic[T], T, error) {
+	return func(lc fx.Lifecycle, sd fx.Shutdowner) (config.Dynamic[T], T, error) {
+		d, err := loadMerged(sources)
+		if err != nil {
+			var zero T
+			return nil, zero, err
+		}
+
+		d.manage(lc, sd)
+
+		return d, d.Load(), nil
+	}
+}
+
+// loadMerged reads the sources of opts and loads their merged config.
+func loadMerged[T any](opts []config.Option[T]) (*Dynamic[T], error) {
+	s := &sources{}
+
+	var rest []config.Option[T]
+
+	for _, opt := range opts {
+		v, ok, err := readSource(opt)
+		if !ok {
+			rest = append(rest, opt)
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("fxconfig: failed to read source %d: %w", len(s.vipers)+1, err)
+		}
+
+		s.vipers = append(s.vipers, v)
+	}
+
+	return loadSources(s, rest)
+}
+
+// loadSources loads the merged config of s, opts must not set a source.
+func loadSources[T any](s *sources, opts []config.Option[T]) (*Dynamic[T], error) {
+	// The merged viper instance gets an empty source, so config.New doesn't
+	// read the default file.
+	opts = append([]config.Option[T]{config.WithConfigReader[T](strings.NewReader(""), "yaml")}, opts...)
+
+	v := viper.NewWithOptions(viper.KeyDelimiter("_"))
+	o := &options[T]{}
+
+	l, _, err := newLoader(v, o, append(opts, config.DisableAutoParse[T]()))
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dynamic[T]{
+		loader:  l,
+		viper:   v,
+		section: loaderSection(l),
+		opts:    o,
+		sources: s,
+	}
+
+	if err := s.merge(v); err != nil {
+		return nil, fmt.Errorf("fxconfig: failed to merge config: %w", err)
+	}
+
+	value, err := d.parse()
+	if err != nil {
+		return nil, fmt.Errorf("fxconfig: failed to load config: %w", err)
+	}
+
+	if err := d.init(value, nil); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// readSource reads the source of opt into a new viper instance. It reports
+// false if opt sets no source.
+func readSource[T any](opt config.Option[T]) (*viper.Viper, bool, error) {
+	v := viper.NewWithOptions(viper.KeyDelimiter("_"))
+	logger := &errorLogger{}
+
+	// The source must be checked before config.New sets the default file.
+	// config.WithConfigPath searches the file, but keeps the default file
+	// set; the file found is set explicitly instead.
+	var ok bool
+	probe := loaderOption[T](func(l reflect.Value) {
+		ok = loaderReadsSource(l)
+		if ok {
+			return
+		}
+
+		if file := v.ConfigFileUsed(); file != "" {
+			reflect.ValueOf(config.WithConfigFile[T](file)).Call([]reflect.Value{l})
+			ok = true
+		}
+
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(logger.err, &notFound) {
+			ok = true
+		}
+	})
+
+	config.New(
+		config.WithViperInstance[T](v),
+		config.WithLogger[T](logger),
+		opt,
+		probe,
+		config.DisableAutoParse[T](),
+	)
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	return v, true, logger.err
+}
+
+// sources are the viper instances of the sources of NewMerged, or of the
+// files in the directory of NewFromDir.
+type sources struct {
+	vipers []*viper.Viper
+	dir    string // of NewFromDir, if set
+}
+
+// read reads the source files again and merges all sources into v. The
+// files of a directory are listed again.
+func (s *sources) read(v *viper.Viper) error {
+	if s.dir != "" {
+		if err := s.scan(); err != nil {
+			return err
+		}
+
+		return s.merge(v)
+	}
+
+	for _, sv := range s.vipers {
+		if sv.ConfigFileUsed() == "" {
+			continue
+		}
+
+		if err := sv.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+
+	return s.merge(v)
+}
+
+// merge replaces the config of v by the merged sources.
+func (s *sources) merge(v *viper.Viper) error {
+	v.SetConfigType("yaml")
+
+	if err := v.ReadConfig(strings.NewReader("")); err != nil {
+		return err
+	}
+
+	for _, sv := range s.vipers {
+		if err := v.MergeConfigMap(sv.AllSettings()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// files returns the source files. The files of a directory are not
+// returned, the directory is watched instead.
+func (s *sources) files() []string {
+	if s.dir != "" {
+		return nil
+	}
+
+	var files []string
+
+	for _, sv := range s.vipers {
+		if file := sv.ConfigFileUsed(); file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// errorLogger is a config.Logger which keeps the first error logged.
+type errorLogger struct {
+	err error
+}
+
+func (l *errorLogger) Info(string, ...any) {}
+
+func (l *errorLogger) Error(msg string, args ...any) {
+	if l.err != nil {
+		return
+	}
+
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			l.err = fmt.Errorf("%s: %w", msg, err)
+			return
+		}
+	}
+
+	l.err = errors.New(msg)
+}
@@ -0,0 +1,242 @@
+package fxconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"schneider.vip/config"
+	"schneider.vip/fxconfig"
+)
+
+type mergedConfig struct {
+	URL    string
+	Hosts  []string
+	Labels map[string]string
+	DB     struct {
+		Host string
+		Port int
+	}
+	TLS *struct {
+		CertFile string
+		KeyFile  string
+	}
+}
+
+func TestNewMerged(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	base := write("base.yml", `
+Service:
+  URL: base.example.com
+  Hosts: [a, b]
+  Labels:
+    team: core
+    tier: backend
+  DB:
+    Host: localhost
+    Port: 5432
+  TLS:
+    CertFile: base.pem
+    KeyFile: base.key
+`)
+	overlay := write("overlay.yml", `
+Service:
+  Hosts: [c]
+  Labels:
+    tier: frontend
+  DB:
+    Host: db.example.com
+  TLS:
+    CertFile: overlay.pem
+`)
+
+	var dyn config.Dynamic[mergedConfig]
+
+	app := fxtest.New(t,
+		fx.Provide(fxconfig.NewMerged(
+			config.WithConfigFile[mergedConfig](base),
+			config.WithConfigFile[mergedConfig](overlay),
+			config.WithConfigReader[mergedConfig](strings.NewReader("Service:\n  TLS:\n    KeyFile: secret.key\n"), "yaml"),
+			config.WithSubSection[mergedConfig]("Service"),
+		)),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	got := dyn.Load()
+
+	if got.URL != "base.example.com" {
+		t.Errorf("URL = %q, want base.example.com", got.URL)
+	}
+
+	if !reflect.DeepEqual(got.Hosts, []string{"c"}) {
+		t.Errorf("Hosts = %v, want the replaced [c]", got.Hosts)
+	}
+
+	if want := map[string]string{"team": "core", "tier": "frontend"}; !reflect.DeepEqual(got.Labels, want) {
+		t.Errorf("Labels = %v, want %v", got.Labels, want)
+	}
+
+	if got.DB.Host != "db.example.com" || got.DB.Port != 5432 {
+		t.Errorf("DB = %+v, want db.example.com:5432", got.DB)
+	}
+
+	if got.TLS == nil || got.TLS.CertFile != "overlay.pem" || got.TLS.KeyFile != "secret.key" {
+		t.Errorf("TLS = %+v, want overlay.pem and secret.key", got.TLS)
+	}
+
+	// A change of any source merges all sources again.
+	write("overlay.yml", "Service:\n  URL: overlay.example.com\n")
+	eventually(t, func() bool { return dyn.Load().URL == "overlay.example.com" })
+
+	if got := dyn.Load(); !reflect.DeepEqual(got.Hosts, []string{"a", "b"}) || got.TLS.KeyFile != "secret.key" {
+		t.Fatalf("config = %+v after reload", got)
+	}
+}
+
+func TestNewMergedMissingSource(t *testing.T) {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(fxconfig.NewMerged(
+			config.WithConfigFile[mergedConfig](filepath.Join(t.TempDir(), "missing.yml")),
+			config.WithSubSection[mergedConfig]("Service"),
+		)),
+		fx.Invoke(func(mergedConfig) {}),
+	)
+
+	if err := app.Err(); err == nil || !strings.Contains(err.Error(), "failed to read source 1") {
+		t.Fatalf("app.Err() = %v", err)
+	}
+}
+
+func TestNewMergedConfigPath(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yml")
+	if err := os.WriteFile(base, []byte("Service:\n  URL: base.example.com\n  Hosts: [a]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	overlays := filepath.Join(dir, "overlays")
+	if err := os.Mkdir(overlays, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay := filepath.Join(overlays, "config.yml")
+	if err := os.WriteFile(overlay, []byte("Service:\n  URL: overlay.example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var dyn config.Dynamic[mergedConfig]
+
+	app := fxtest.New(t,
+		fx.Provide(fxconfig.NewMerged(
+			config.WithConfigFile[mergedConfig](base),
+			config.WithConfigPath[mergedConfig]([]string{filepath.Join(dir, "missing"), overlays}),
+			config.WithSubSection[mergedConfig]("Service"),
+		)),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if got := dyn.Load(); got.URL != "overlay.example.com" || !reflect.DeepEqual(got.Hosts, []string{"a"}) {
+		t.Fatalf("config = %+v, want the URL of the overlay and the hosts of the base", got)
+	}
+
+	// The file found in the paths is watched like any other source.
+	if err := os.WriteFile(overlay, []byte("Service:\n  URL: changed.example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return dyn.Load().URL == "changed.example.com" })
+
+	t.Run("not found", func(t *testing.T) {
+		app := fx.New(
+			fx.NopLogger,
+			fx.Provide(fxconfig.NewMerged(
+				config.WithConfigFile[mergedConfig](base),
+				config.WithConfigPath[mergedConfig]([]string{filepath.Join(dir, "missing")}),
+				config.WithSubSection[mergedConfig]("Service"),
+			)),
+			fx.Invoke(func(mergedConfig) {}),
+		)
+
+		if err := app.Err(); err == nil || !strings.Contains(err.Error(), "failed to read source 2") {
+			t.Fatalf("app.Err() = %v", err)
+		}
+	})
+}
+
+func TestNewFromDir(t *testing.T) {
+	for name, opts := range map[string][]config.Option[mergedConfig]{
+		"notify": nil,
+		"poll":   {fxconfig.WithPollInterval[mergedConfig](20 * time.Millisecond)},
+	} {
+		t.Run(name, func(t *testing.T) { testNewFromDir(t, opts...) })
+	}
+}
+
+func testNewFromDir(t *testing.T, opts ...config.Option[mergedConfig]) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		// Replace the file atomically, so the watcher never reloads a
+		// partially written fragment.
+		tmp := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("10-base.yaml", "Service:\n  URL: base.example.com\n  DB:\n    Host: localhost\n    Port: 5432\n")
+	write("20-db.yaml", "Service:\n  DB:\n    Host: db.example.com\n")
+	write(".30-hidden.yaml", "Service:\n  URL: hidden.example.com\n")
+	write("40-notes.txt", "Service:\n  URL: notes.example.com\n")
+
+	var dyn config.Dynamic[mergedConfig]
+
+	app := fxtest.New(t,
+		fx.Provide(fxconfig.NewFromDir(dir, append(opts, config.WithSubSection[mergedConfig]("Service"))...)),
+		fx.Populate(&dyn),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	got := dyn.Load()
+	if got.URL != "base.example.com" || got.DB.Host != "db.example.com" || got.DB.Port != 5432 {
+		t.Fatalf("config = %+v", got)
+	}
+
+	// An added file is merged.
+	write("30-url.yaml", "Service:\n  URL: added.example.com\n")
+	eventually(t, func() bool { return dyn.Load().URL == "added.example.com" })
+
+	// The keys of a removed file disappear.
+	if err := os.Remove(filepath.Join(dir, "20-db.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool { return dyn.Load().DB.Host == "localhost" })
+
+	if _, _, err := fxconfig.NewFromDir[mergedConfig](filepath.Join(dir, "missing"))(fxtest.NewLifecycle(t), nil); err == nil {
+		t.Fatal("NewFromDir of a missing directory succeeded")
+	}
+}
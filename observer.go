@@ -0,0 +1,43 @@
+package fxconfig
+
+// ReloadObserver is notified of the reloads of a Dynamic Config, e.g. to
+// export metrics. config is the name of the config type, or the name set by
+// WithName. The calls are serialized per Dynamic Config and must
+// not block.
+type ReloadObserver interface {
+	// Reloaded is called after a reload committed a changed config of
+	// generation.
+	Reloaded(config string, generation uint64)
+
+	// ReloadFailed is called after a failed reload.
+	ReloadFailed(config string, err error)
+}
+
+// CallbackObserver is implemented by a ReloadObserver which is also notified
+// of the panics of reload callbacks, e.g. of OnReload. The reload was
+// committed already, so these are not reported by ReloadFailed.
+type CallbackObserver interface {
+	// CallbackPanicked is called after a reload callback panicked.
+	CallbackPanicked(config string, err error)
+}
+
+// AddObserver registers obs to be notified of reloads, and of callback
+// panics if obs implements CallbackObserver.
+func (d *Dynamic[T]) AddObserver(obs ReloadObserver) {
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+
+	d.observers = append(d.observers, obs)
+}
+
+// observe calls fn with each registered observer. It must be called with
+// d.mu held.
+func (d *Dynamic[T]) observe(fn func(obs ReloadObserver, config string)) {
+	d.listenersMu.Lock()
+	observers := d.observers
+	d.listenersMu.Unlock()
+
+	for _, obs := range observers {
+		fn(obs, d.opts.label())
+	}
+}
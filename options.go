@@ -0,0 +1,317 @@
+package fxconfig
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"go.uber.org/fx/fxevent"
+	"schneider.vip/config"
+)
+
+// options holds the settings of the fxconfig options. fxconfig options are
+// config.Options, so they can be passed to the constructors together with
+// the options of the config package.
+type options[T any] struct {
+	validators  []func(T) error
+	processors  []func(*T) error
+	guards      []func(T) error
+	def         *T
+	eventLogger fxevent.Logger
+	secretTag   string
+	name        string
+	debounce    time.Duration
+	errorSink   func(error)
+
+	retryAttempts int
+	retryBase     time.Duration
+	failurePolicy ReloadFailurePolicy
+	envPrefix     *string
+	flags         *flagSet
+	flagValues    map[string]string // of the set flags, read at the initial load
+	diffs         []func([]FieldChange)
+	rawSinks      []func([]byte)
+	reloadSignals []chan<- uint64
+	static        bool
+	optional      bool
+	requireFile   bool // fail if the config file can't be read
+	verifyWatch   bool
+	startupHook   bool
+
+	minReloadInterval time.Duration
+	startupLogger     fxevent.Logger
+	pollInterval      time.Duration
+	decodeHooks       []mapstructure.DecodeHookFunc
+	strictKeys        bool
+	readyPredicate    func(T) bool
+
+	err error // of invalid options, fails the constructor
+}
+
+// building maps the address of a loader, which is created by an fxconfig
+// constructor, to the options collected for it.
+var building sync.Map
+
+// newOption returns a config.Option, which applies fn to the fxconfig
+// options of the loader it is applied to. Applied to a loader that was not
+// created by fxconfig, e.g. by config.New, the option does nothing.
+func newOption[T any](fn func(*options[T])) config.Option[T] {
+	return loaderOption[T](func(l reflect.Value) {
+		if o, ok := building.Load(l.Pointer()); ok {
+			fn(o.(*options[T]))
+		}
+	})
+}
+
+// WithValidator is an option to validate the config. The validator runs
+// after the initial load, on error the constructor fails. It also runs on
+// each reload, an invalid config is logged and the last valid config is kept.
+// Any func can be used, e.g. a struct tag based validator:
+//
+//	validate := validator.New()
+//	fxconfig.WithValidator(func(c ServiceConfig) error { return validate.Struct(c) })
+func WithValidator[T any](v func(T) error) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.validators = append(o.validators, v)
+	})
+}
+
+// WithName is an option to label the config by name, e.g. to tell two
+// configs of the same type apart. The name is used instead of the type name
+// in the logs, the errors passed to the error sink, the config label of
+// ReloadObservers like the Prometheus metrics, Health.Name and the
+// ConfigDescriptor. The logs of WithEventLogger and WithStartupLog keep the
+// type and add the name.
+func WithName[T any](name string) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.name = name
+	})
+}
+
+// label returns the name of the config set by WithName, otherwise the name
+// of T.
+func (o *options[T]) label() string {
+	if o.name != "" {
+		return o.name
+	}
+
+	return typeName[T]()
+}
+
+// WithPostProcess is an option to adjust the parsed config in place, e.g. to
+// expand ${VAR} placeholders in string fields. fn runs after parsing and the
+// overrides of WithEnvPrefix and WithFlags, before the validators, on the
+// initial load and on each reload. A reload runs it while holding its lock,
+// before the commit, so no reader observes the config before fn. An error
+// of fn fails the initial load; on a reload it is handled by the reload
+// failure policy, see WithReloadFailurePolicy, and the last config is kept.
+func WithPostProcess[T any](fn func(*T) error) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.processors = append(o.processors, fn)
+	})
+}
+
+// postProcess runs the post processors of WithPostProcess on cfg in order.
+func (o *options[T]) postProcess(cfg T) (T, error) {
+	for _, fn := range o.processors {
+		if err := fn(&cfg); err != nil {
+			return cfg, fmt.Errorf("post-process: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// WithStatic is an option to disable reloads, e.g. for a config baked into
+// an immutable image. The config is loaded once: no file watcher or other
+// goroutine is started and no lifecycle hook is registered, Load always
+// returns the initial config. Reload does nothing, so reload callbacks such
+// as OnReload, WithSignalReload or WithReloadDiff become no-ops. All other
+// options apply as usual.
+func WithStatic[T any]() config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.static = true
+	})
+}
+
+// Optional is an option to accept a missing sub section, e.g. an optional
+// feature block: if the section set by config.WithSubSection is absent from
+// the config, the config is the zero value of T, or the default of
+// WithDefault if set. A present section is parsed as usual and fails if it is
+// malformed, e.g. not a map. The same applies to reloads: a section removed
+// from the config is committed as the zero value or default.
+func Optional[T any]() config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.optional = true
+	})
+}
+
+// WithReloadGuard is an option to approve or reject a reloaded config. Unlike
+// a validator, the guard runs on reloads only: a candidate is committed, and
+// visible by Load, only if fn returns nil. A rejected candidate is logged and
+// the last config is kept. The guard runs before the commit while the reload
+// holds its lock, so no reader observes a rejected config.
+func WithReloadGuard[T any](fn func(candidate T) error) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.guards = append(o.guards, fn)
+	})
+}
+
+// WithDefault is an option to set a default config. Unlike config.WithDefault
+// the default is merged field-wise: keys present in the config override the
+// fields of def, absent keys keep them. An explicit zero value in the config,
+// e.g. false for a bool with ",omitempty", still overrides the default. If
+// the sub section is missing entirely, def is used.
+func WithDefault[T any](def T) config.Option[T] {
+	def = deepCopy(def)
+
+	return newOption(func(o *options[T]) {
+		o.def = &def
+	})
+}
+
+// WithDebounce is an option to coalesce changes of the watched file within d
+// into a single reload. Editors and sync tools often write a file several
+// times in a row, only the state after the last write within d is reloaded.
+// A pending reload is still done when the watcher stops.
+func WithDebounce[T any](d time.Duration) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.debounce = d
+	})
+}
+
+// WithRetry is an option to retry a failed initial load, e.g. while a mounted
+// secret is not present yet. The config is loaded up to attempts times in
+// total, waiting base, 2*base, 4*base and so on with jitter in between. Each
+// retry is logged. Constructors run in fx.New, before the start timeout of
+// fx applies, so only attempts and base bound the retries; with
+// NewWithContext, they also stop when the context is done. The last error is
+// returned if all attempts failed. Reloads are not retried.
+func WithRetry[T any](attempts int, base time.Duration) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.retryAttempts = attempts
+		o.retryBase = base
+	})
+}
+
+// retryDelay returns the backoff before the retry of attempt: base doubled
+// per attempt, of which a random half is jitter.
+func (o *options[T]) retryDelay(attempt int) time.Duration {
+	d := o.retryBase
+	if d <= 0 {
+		return 0
+	}
+
+	for range attempt - 1 {
+		if d > math.MaxInt64/2 {
+			break
+		}
+
+		d *= 2
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
+
+// WithReloadSignal is an option to send the generation of each committed
+// reload on ch, e.g. for tests to wait until a written config is applied:
+//
+//	reloaded := make(chan uint64, 1)
+//	// ... fxconfig.WithReloadSignal[ServiceConfig](reloaded)
+//	writeConfig(path)
+//	<-reloaded
+//
+// The send doesn't block: if ch is not ready, e.g. unbuffered without a
+// waiting receiver or full, the generation is dropped. Use a buffered
+// channel to not miss reloads. Reloads which don't change the config are
+// not sent.
+func WithReloadSignal[T any](ch chan<- uint64) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.reloadSignals = append(o.reloadSignals, ch)
+	})
+}
+
+// signalReload sends generation on the channels of WithReloadSignal without
+// blocking.
+func (o *options[T]) signalReload(generation uint64) {
+	for _, ch := range o.reloadSignals {
+		select {
+		case ch <- generation:
+		default:
+		}
+	}
+}
+
+// WithMinReloadInterval is an option to keep at least d between the reloads
+// of the file watcher, e.g. to protect expensive reload callbacks like
+// reopening a database pool from thrashing under sustained changes. Unlike
+// WithDebounce, which waits for the writes to settle, a change within d after
+// the last reload is applied when d elapsed. Further changes until then
+// collapse into that reload, which reads the latest state. A waiting change
+// is still reloaded when the watcher stops. Reload and WithSignalReload are
+// not limited.
+func WithMinReloadInterval[T any](d time.Duration) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.minReloadInterval = d
+	})
+}
+
+// fail records err of an invalid option.
+func (o *options[T]) fail(err error) {
+	o.err = errors.Join(o.err, err)
+}
+
+// decodes reports whether fxconfig decodes the config itself instead of the
+// loader of the config package.
+func (o *options[T]) decodes() bool {
+	return o.def != nil || o.optional || len(o.decodeHooks) > 0 || o.strictKeys
+}
+
+// unmanaged returns an error if o sets an option which needs the fx
+// lifecycle of a managed constructor.
+func (o *options[T]) unmanaged() error {
+	if o.startupHook {
+		return errors.New("fxconfig: WithStartupHook needs a managed constructor, e.g. NewManaged or Module")
+	}
+
+	if o.verifyWatch && !o.static {
+		return errors.New("fxconfig: WithVerifyWatch needs a managed constructor, e.g. NewManaged or Module")
+	}
+
+	if o.failurePolicy == Fatal && !o.static {
+		return errors.New("fxconfig: the Fatal reload failure policy needs a managed constructor, e.g. NewManaged or Module")
+	}
+
+	return nil
+}
+
+// guard runs all reload guards on candidate.
+func (o *options[T]) guard(candidate T) error {
+	var errs []error
+
+	for _, g := range o.guards {
+		if err := g(candidate); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate runs all validators on cfg.
+func (o *options[T]) validate(cfg T) error {
+	var errs []error
+
+	for _, v := range o.validators {
+		if err := v(cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,22 @@
+package fxconfig
+
+import (
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// Override returns an fx.Option which replaces the config of T by value,
+// e.g. in integration tests which build the real app but must not depend on
+// its config source. It decorates the config.Dynamic[T] and T provided by
+// the real constructor, also within a Module, with a static config like
+// Static. The real constructor is not called, so its source is not read and
+// no watcher is started. Consumers of Loader[T], *Dynamic[T], *Health[T]
+// or *Status[T] provided by Module get the static config as well.
+//
+//	fxtest.New(t, app.Module, fxconfig.Override(ServiceConfig{URL: "test"}))
+func Override[T any](value T) fx.Option {
+	return fx.Decorate(func() (config.Dynamic[T], T) {
+		d := newStatic(value)
+		return d, d.Load()
+	})
+}
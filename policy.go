@@ -0,0 +1,67 @@
+package fxconfig
+
+import (
+	"log/slog"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// ReloadFailurePolicy decides what happens when a reload fails, i.e. the
+// source can't be read or parsed, or the config is invalid or rejected.
+type ReloadFailurePolicy int
+
+const (
+	// KeepLast keeps the last config: Load continues to return the last
+	// successfully reloaded config and the failure is logged and reported to
+	// the error sink, see WithErrorSink. This is the default.
+	KeepLast ReloadFailurePolicy = iota
+
+	// Fatal shuts the app down gracefully by fx.Shutdowner with exit code
+	// FatalExitCode, in addition to KeepLast, so a service never keeps
+	// running on a stale config. This is intended for fail-closed
+	// deployments. The shutdown is fired asynchronously and only once, the
+	// OnStop hooks of the app run as usual. It requires a managed
+	// constructor with an fx.Shutdowner, i.e. NewManaged, Module or
+	// NewNamed. New, NewE, NewWithContext and NewValue fail with it.
+	Fatal
+)
+
+// FatalExitCode is the exit code of the shutdown by the Fatal policy, as
+// reported by fx.ShutdownSignal of app.Wait.
+const FatalExitCode = 1
+
+// WithReloadFailurePolicy is an option to set what happens when a reload
+// fails, see ReloadFailurePolicy. The initial load is not affected, its
+// failure always fails the constructor.
+func WithReloadFailurePolicy[T any](p ReloadFailurePolicy) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.failurePolicy = p
+	})
+}
+
+// setShutdowner sets the fx.Shutdowner used by the Fatal policy.
+func (d *Dynamic[T]) setShutdowner(sd fx.Shutdowner) {
+	d.shutdowner = sd
+}
+
+// applyFailurePolicy applies the reload failure policy to the failed reload
+// with err.
+func (d *Dynamic[T]) applyFailurePolicy(err error) {
+	if d.opts.failurePolicy != Fatal || d.shutdowner == nil {
+		return
+	}
+
+	d.shutdownOnce.Do(func() {
+		slog.Error("Shutting down after failed config reload",
+			"config", d.opts.label(), "policy", "Fatal", "error", err)
+
+		// Shutdown must not block the reload, which might run in the
+		// watcher that is stopped by the shutdown.
+		go func() {
+			if serr := d.shutdowner.Shutdown(fx.ExitCode(FatalExitCode)); serr != nil {
+				slog.Error("Failed to shut down after failed config reload", "error", serr)
+			}
+		}()
+	})
+}
@@ -0,0 +1,150 @@
+package fxconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"schneider.vip/config"
+)
+
+// WithPollInterval is an option to poll the config files every d instead of
+// watching them by native file system notifications, e.g. on network file
+// systems like NFS, which don't deliver inotify events. A file is changed if
+// its modification time or size differ from the last poll, or if it
+// appeared or disappeared. Polling replaces the notifications entirely, even
+// if the file system supports them, so a change is noticed up to d later.
+// Options like WithDebounce and WithMinReloadInterval apply to the polled
+// changes as usual. d must be positive, otherwise the constructor fails.
+func WithPollInterval[T any](d time.Duration) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		if d <= 0 {
+			o.fail(fmt.Errorf("fxconfig: poll interval must be positive, got %s", d))
+			return
+		}
+
+		o.pollInterval = d
+	})
+}
+
+// notifier delivers the change events of the watched files, either of an
+// fsnotify.Watcher or of a poller.
+type notifier struct {
+	events <-chan fsnotify.Event
+	errors <-chan error
+	close  func() error
+}
+
+// poller polls the stat of files every interval and sends a change event
+// for each changed file.
+type poller struct {
+	events chan fsnotify.Event
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// fileState is the polled state of a file.
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+	files   string // the states of the config files of a directory
+}
+
+// statFile returns the state of file, a file which can't be stat'ed doesn't
+// exist. The state of a directory includes the states of its config files.
+func statFile(file string) fileState {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileState{}
+	}
+
+	state := fileState{exists: true, modTime: info.ModTime(), size: info.Size()}
+
+	if info.IsDir() {
+		files, _ := dirFiles(file)
+
+		var b strings.Builder
+		for _, f := range files {
+			s := statFile(f)
+			fmt.Fprintf(&b, "%s %d %d\n", f, s.modTime.UnixNano(), s.size)
+		}
+
+		state.files = b.String()
+	}
+
+	return state
+}
+
+// equal reports whether s and o are the same state.
+func (s fileState) equal(o fileState) bool {
+	return s.exists == o.exists && s.modTime.Equal(o.modTime) && s.size == o.size && s.files == o.files
+}
+
+// newPoller starts polling files every interval.
+func newPoller(files []string, interval time.Duration) *poller {
+	p := &poller{
+		events: make(chan fsnotify.Event),
+		stop:   make(chan struct{}),
+	}
+
+	states := make([]fileState, len(files))
+	for i, file := range files {
+		states[i] = statFile(file)
+	}
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+
+			for i, file := range files {
+				state := statFile(file)
+				if state.equal(states[i]) {
+					continue
+				}
+
+				states[i] = state
+
+				op := fsnotify.Write
+				if !state.exists {
+					op = fsnotify.Remove
+				}
+
+				select {
+				case p.events <- fsnotify.Event{Name: file, Op: op}:
+				case <-p.stop:
+					return
+				}
+			}
+		}
+	}()
+
+	return p
+}
+
+// notifier returns the notifier of p.
+func (p *poller) notifier() *notifier {
+	return &notifier{
+		events: p.events,
+		close: func() error {
+			close(p.stop)
+			p.wg.Wait()
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,147 @@
+package fxconfig
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// Provider builds an fx.Option which provides a config in several roles at
+// once from a single load: as the config itself, as interfaces and as a
+// member of value groups. It avoids registering a constructor per role,
+// which would read the source once per role. Create one by NewProvider and
+// pass Option to fx:
+//
+//	fxconfig.NewProvider[ServiceConfig](opts...).
+//		As(new(Named)).
+//		InGroup("startup-configs").
+//		Option()
+//
+// Provider is immutable: its methods return a new Provider.
+type Provider[T any] struct {
+	opts   []config.Option[T]
+	ifaces []any
+	groups []string
+	name   string
+}
+
+// NewProvider returns a Provider of the config of T loaded like by
+// NewManaged with opts.
+func NewProvider[T any](opts ...config.Option[T]) *Provider[T] {
+	return &Provider[T]{opts: opts}
+}
+
+// As returns a Provider which provides the parsed config as each of ifaces
+// as well, given as pointers to the interfaces like for fx.As, e.g.
+// new(Named). T or *T must implement them, with a pointer receiver the
+// interface wraps a pointer to a copy of the config.
+func (p *Provider[T]) As(ifaces ...any) *Provider[T] {
+	next := p.clone()
+	next.ifaces = append(next.ifaces, ifaces...)
+
+	return next
+}
+
+// InGroup returns a Provider which puts the parsed config into the value
+// group group as well.
+func (p *Provider[T]) InGroup(group string) *Provider[T] {
+	next := p.clone()
+	next.groups = append(next.groups, group)
+
+	return next
+}
+
+// Named returns a Provider which names the Dynamic Config, the parsed config
+// and its interfaces name, like NewNamed, instead of providing them unnamed.
+// The value groups are not affected.
+func (p *Provider[T]) Named(name string) *Provider[T] {
+	next := p.clone()
+	next.name = name
+
+	return next
+}
+
+func (p *Provider[T]) clone() *Provider[T] {
+	next := *p
+	next.ifaces = append([]any(nil), p.ifaces...)
+	next.groups = append([]string(nil), p.groups...)
+
+	return &next
+}
+
+// provided is the single load shared by the roles of a Provider.
+type provided[T any] struct {
+	dyn config.Dynamic[T]
+	cfg T
+}
+
+// Option returns the fx.Option which provides the config in all roles of p:
+// config.Dynamic[T] and T, optionally named, the interfaces of As and the
+// value groups of InGroup. The config is loaded once by a constructor
+// private to the returned fx.Module, fails like NewManaged, and each role
+// gets the same Dynamic Config. An interface which neither T nor *T
+// implements fails the app.
+func (p *Provider[T]) Option() fx.Option {
+	var tags []fx.Annotation
+	if p.name != "" {
+		tag := fmt.Sprintf(`name:"%s"`, p.name)
+		tags = append(tags, fx.ResultTags(tag, tag))
+	}
+
+	newManaged := NewManaged(p.opts...)
+
+	opts := []fx.Option{
+		fx.Provide(fx.Private, func(lc fx.Lifecycle, sd fx.Shutdowner) (*provided[T], error) {
+			dyn, cfg, err := newManaged(lc, sd)
+			if err != nil {
+				return nil, err
+			}
+
+			return &provided[T]{dyn: dyn, cfg: cfg}, nil
+		}),
+		fx.Provide(fx.Annotate(func(s *provided[T]) (config.Dynamic[T], T) {
+			return s.dyn, s.cfg
+		}, tags...)),
+	}
+
+	for _, iface := range p.ifaces {
+		opts = append(opts, p.provideAs(iface))
+	}
+
+	for _, group := range p.groups {
+		opts = append(opts, fx.Provide(fx.Annotate(func(s *provided[T]) T {
+			return s.cfg
+		}, fx.ResultTags(fmt.Sprintf(`group:"%s"`, group)))))
+	}
+
+	return fx.Module(fmt.Sprintf("fxconfig.provider[%s]", reflect.TypeFor[T]()), opts...)
+}
+
+// provideAs provides the parsed config as the interface iface points to.
+func (p *Provider[T]) provideAs(iface any) fx.Option {
+	var tags []fx.Annotation
+	if p.name != "" {
+		tags = append(tags, fx.ResultTags(fmt.Sprintf(`name:"%s"`, p.name)))
+	}
+
+	typ := reflect.TypeFor[T]()
+
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Pointer || it.Elem().Kind() != reflect.Interface {
+		return fx.Error(fmt.Errorf("fxconfig: As of %s needs a pointer to an interface, got %T", typ, iface))
+	}
+
+	switch {
+	case typ.Implements(it.Elem()):
+		return fx.Provide(fx.Annotate(func(s *provided[T]) T { return s.cfg }, append(tags, fx.As(iface))...))
+	case reflect.PointerTo(typ).Implements(it.Elem()):
+		return fx.Provide(fx.Annotate(func(s *provided[T]) *T {
+			cfg := s.cfg
+			return &cfg
+		}, append(tags, fx.As(iface))...))
+	}
+
+	return fx.Error(fmt.Errorf("fxconfig: neither %s nor *%s implement %s", typ, typ, it.Elem()))
+}
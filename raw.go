@@ -0,0 +1,29 @@
+package fxconfig
+
+import (
+	"schneider.vip/config"
+)
+
+// WithRawSink is an option to get the raw bytes of the config file, e.g. to
+// log a checksum of the config in effect. fn is called with the bytes the
+// initial config was parsed from and again with the bytes of each committed
+// reload, so a hash of them always matches the current generation. fn is
+// not called for configs not read from a single file, e.g. from a reader.
+// The bytes contain secrets as they are and must not be modified. See also
+// Dynamic.Raw.
+func WithRawSink[T any](fn func(raw []byte)) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.rawSinks = append(o.rawSinks, fn)
+	})
+}
+
+// sinkRaw calls the raw sinks with raw, if any.
+func (o *options[T]) sinkRaw(raw []byte) {
+	if raw == nil {
+		return
+	}
+
+	for _, fn := range o.rawSinks {
+		fn(raw)
+	}
+}
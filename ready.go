@@ -0,0 +1,82 @@
+package fxconfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"schneider.vip/config"
+)
+
+// WithReadyPredicate is an option to set when the config is ready for
+// Ready, e.g. once a control plane pushed the endpoints of a service. By
+// default the config is ready if it is not the zero value of T.
+func WithReadyPredicate[T any](ready func(T) bool) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.readyPredicate = ready
+	})
+}
+
+// ready reports whether cfg is ready, see WithReadyPredicate.
+func (o *options[T]) ready(cfg T) bool {
+	if o.readyPredicate != nil {
+		return o.readyPredicate(deepCopy(cfg))
+	}
+
+	return !reflect.ValueOf(&cfg).Elem().IsZero()
+}
+
+// Ready blocks until the config is ready or ctx is done, for sources which
+// are populated asynchronously, so the initial load may yield an empty
+// config. The config is ready if it is not the zero value of T, or as set
+// by WithReadyPredicate. Ready checks the config in use first, then it is
+// woken by each committed reload until the config is ready. If ctx is done
+// before, it returns an error wrapping the error of ctx. Ready starts no
+// goroutine, so a cancelled wait leaves nothing behind.
+//
+// As an OnStart hook, it lets the hooks of dependents wait for a meaningful
+// config:
+//
+//	fx.Invoke(func(lc fx.Lifecycle, d *fxconfig.Dynamic[ServiceConfig]) {
+//		lc.Append(fx.StartHook(d.Ready))
+//	})
+func (d *Dynamic[T]) Ready(ctx context.Context) error {
+	for {
+		// The signal is taken before the check, so a commit in between
+		// is not missed.
+		committed := d.commitSignal()
+
+		if d.opts.ready(d.current.Load().value) {
+			return nil
+		}
+
+		select {
+		case <-committed:
+		case <-ctx.Done():
+			return fmt.Errorf("fxconfig: %s: config not ready: %w", d.opts.label(), ctx.Err())
+		}
+	}
+}
+
+// commitSignal returns a channel which is closed by the next commit.
+func (d *Dynamic[T]) commitSignal() <-chan struct{} {
+	d.commitMu.Lock()
+	defer d.commitMu.Unlock()
+
+	if d.committed == nil {
+		d.committed = make(chan struct{})
+	}
+
+	return d.committed
+}
+
+// signalCommit wakes the waiters of commitSignal.
+func (d *Dynamic[T]) signalCommit() {
+	d.commitMu.Lock()
+	defer d.commitMu.Unlock()
+
+	if d.committed != nil {
+		close(d.committed)
+		d.committed = nil
+	}
+}
@@ -0,0 +1,115 @@
+package fxconfig
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"schneider.vip/config"
+)
+
+// redacted replaces the values of secret fields.
+const redacted = "***"
+
+// defaultSecretTag is the struct tag of secret fields, unless set by
+// WithRedactTag.
+const defaultSecretTag = "secret"
+
+// WithRedactTag is an option to set the struct tag of secret fields, which
+// are redacted in the logs of WithEventLogger and WithStartupLog and in the
+// changes of WithReloadDiff. A field is secret if the tag is "true", e.g.
+// `sensitive:"true"` with tag "sensitive". The default tag is "secret".
+func WithRedactTag[T any](tag string) config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.secretTag = tag
+	})
+}
+
+// redactTag returns the struct tag of secret fields.
+func (o *options[T]) redactTag() string {
+	if o.secretTag == "" {
+		return defaultSecretTag
+	}
+
+	return o.secretTag
+}
+
+// isSecret reports whether the field f is tagged as secret by tag.
+func isSecret(f reflect.StructField, tag string) bool {
+	return f.Tag.Get(tag) == "true"
+}
+
+// leafTypes are the types represented as is, instead of walking their
+// fields. Other structs are walked even if they implement fmt.Stringer, a
+// String method could reveal secret fields.
+var leafTypes = map[reflect.Type]bool{
+	reflect.TypeFor[time.Time]():     true,
+	reflect.TypeFor[time.Duration](): true,
+}
+
+// isLeaf reports whether values of t are represented as is.
+func isLeaf(t reflect.Type) bool {
+	return leafTypes[t]
+}
+
+// redact returns a representation of v for logs, in which the values of
+// struct fields tagged as secret by tag, e.g. `secret:"true"`, are replaced
+// by "***". Nested structs, maps and slices are walked. Structs are
+// represented by maps of their config keys, except time.Time.
+func redact(v any, tag string) any {
+	return redactValue(reflect.ValueOf(v), tag)
+}
+
+func redactValue(v reflect.Value, tag string) any {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return redactValue(v.Elem(), tag)
+	case reflect.Struct:
+		if isLeaf(v.Type()) {
+			return v.Interface()
+		}
+
+		m := make(map[string]any, v.NumField())
+
+		for i := range v.NumField() {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			if isSecret(f, tag) {
+				m[fieldName(f)] = redacted
+			} else {
+				m[fieldName(f)] = redactValue(v.Field(i), tag)
+			}
+		}
+
+		return m
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value(), tag)
+		}
+
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+
+		s := make([]any, v.Len())
+		for i := range v.Len() {
+			s[i] = redactValue(v.Index(i), tag)
+		}
+
+		return s
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,128 @@
+package fxconfig
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// OnReload returns an fx.Option which registers fn at the Dynamic Config of T.
+// fn is called with the previous and the new config whenever a reload
+// changes the config. It is not called for the initial load, calls are
+// serialized and a panic in fn is recovered, logged with its stack trace and
+// reported to the error sink and to CallbackObservers, so the watcher keeps
+// running. The reload itself succeeded, so the health of the config is not
+// affected.
+//
+// fn may be slow, e.g. reopen a connection pool: the file watcher reloads in
+// a single worker, so neither goroutines nor calls pile up. Changes arriving
+// while fn runs collapse into one pending reload, which reads the latest
+// config after fn returned. So fn sees the newest config last, possibly
+// without the configs in between.
+func OnReload[T any](fn func(old, new T)) fx.Option {
+	return fx.Invoke(func(dyn config.Dynamic[T]) error {
+		d, err := asDynamic(dyn)
+		if err != nil {
+			return err
+		}
+
+		d.onReload(fn)
+
+		return nil
+	})
+}
+
+// ReloadEvent describes a reload which changed the config, see OnReloadCtx.
+type ReloadEvent[T any] struct {
+	Old        T         // the previous config
+	New        T         // the new config
+	Generation uint64    // of the new config, see Dynamic.Generation
+	Time       time.Time // when the new config was committed
+}
+
+// OnReloadCtx returns an fx.Option like OnReload, which calls fn with a
+// ReloadEvent, so fn gets the generation and the time of the reload besides
+// the configs, e.g. to tag an audit record. The generation matches the one
+// of Status and of the reload metrics.
+func OnReloadCtx[T any](fn func(ev ReloadEvent[T])) fx.Option {
+	return fx.Invoke(func(dyn config.Dynamic[T]) error {
+		d, err := asDynamic(dyn)
+		if err != nil {
+			return err
+		}
+
+		d.onReloadEvent(fn)
+
+		return nil
+	})
+}
+
+// OnFirstLoad returns an fx.Option which calls fn once with the config of T
+// when the app starts, e.g. for initialization which needs the config but
+// must not run again on reloads. Unlike OnReload, fn is called for the
+// initial config only. fn runs in an OnStart hook, so it is ordered like the
+// hooks of other fx.Invoke calls, and its error aborts the start of the app.
+func OnFirstLoad[T any](fn func(T) error) fx.Option {
+	return fx.Invoke(func(lc fx.Lifecycle, dyn config.Dynamic[T]) {
+		lc.Append(fx.StartHook(func() error {
+			if err := fn(dyn.Load()); err != nil {
+				return fmt.Errorf("fxconfig: first load: %w", err)
+			}
+
+			return nil
+		}))
+	})
+}
+
+// asDynamic returns the fxconfig Dynamic behind dyn.
+func asDynamic[T any](dyn config.Dynamic[T]) (*Dynamic[T], error) {
+	d, ok := dyn.(*Dynamic[T])
+	if !ok {
+		return nil, fmt.Errorf("fxconfig: %T is not provided by fxconfig", dyn)
+	}
+
+	return d, nil
+}
+
+// onReload registers fn to be called on config changes.
+func (d *Dynamic[T]) onReload(fn func(old, new T)) {
+	d.onReloadEvent(func(ev ReloadEvent[T]) { fn(ev.Old, ev.New) })
+}
+
+// onReloadEvent registers fn to be called with the event of config changes.
+func (d *Dynamic[T]) onReloadEvent(fn func(ev ReloadEvent[T])) {
+	d.listenersMu.Lock()
+	defer d.listenersMu.Unlock()
+
+	d.listeners = append(d.listeners, fn)
+}
+
+// notify calls the registered reload functions with ev. It must be called
+// with d.mu held, so calls are serialized.
+func (d *Dynamic[T]) notify(ev ReloadEvent[T]) {
+	d.listenersMu.Lock()
+	listeners := d.listeners
+	d.listenersMu.Unlock()
+
+	for _, fn := range listeners {
+		d.callListener(fn, ReloadEvent[T]{
+			Old:        deepCopy(ev.Old),
+			New:        deepCopy(ev.New),
+			Generation: ev.Generation,
+			Time:       ev.Time,
+		})
+	}
+}
+
+// callListener calls fn, a panic of fn is reported to the error sink.
+func (d *Dynamic[T]) callListener(fn func(ev ReloadEvent[T]), ev ReloadEvent[T]) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.callbackPanicked(r)
+		}
+	}()
+
+	fn(ev)
+}
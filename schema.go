@@ -0,0 +1,172 @@
+package fxconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// schemaDialect is the JSON Schema version of Schema.
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema document of the config of T, e.g. to publish
+// it for editors which validate and complete config files. Fields are named
+// like mapstructure decodes them: by the name of their mapstructure tag or
+// else their Go name, and the fields of an embedded struct tagged
+// `mapstructure:",squash"` belong to the embedding struct. Fields tagged
+// `mapstructure:"-"` and unexported fields are left out.
+//
+// A field is required, unless it is tagged omitempty or is a pointer, which
+// may also be null. Nested structs are objects, slices and arrays are
+// arrays, maps are objects of their values and a map tagged
+// `mapstructure:",remain"` allows any further keys of its struct. A
+// time.Duration is a string like "1m30s" or an integer of nanoseconds, a
+// time.Time a date-time string. Types without a JSON representation, like
+// channels and funcs, fail.
+func Schema[T any]() ([]byte, error) {
+	s, err := schemaOf(reflect.TypeFor[T](), make(map[reflect.Type]bool))
+	if err != nil {
+		return nil, fmt.Errorf("fxconfig: schema of %s: %w", typeName[T](), err)
+	}
+
+	s["$schema"] = schemaDialect
+	s["title"] = typeName[T]()
+
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// schemaOf returns the JSON Schema of t. A type in visiting is recursive, its
+// schema allows any value.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) (map[string]any, error) {
+	switch t {
+	case reflect.TypeFor[time.Duration]():
+		return map[string]any{"type": []string{"string", "integer"}}, nil
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Interface:
+		return map[string]any{}, nil
+	case reflect.Pointer:
+		s, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		return nullable(s), nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Map:
+		values, err := schemaOf(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{}, nil
+		}
+
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		s := map[string]any{"type": "object"}
+		properties := make(map[string]any)
+
+		var required []string
+		if err := structSchema(t, visiting, s, properties, &required); err != nil {
+			return nil, err
+		}
+
+		s["properties"] = properties
+		if len(required) > 0 {
+			slices.Sort(required)
+			s["required"] = required
+		}
+
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structSchema adds the fields of the struct t to properties and the names
+// of the required ones to required. The fields of squashed structs are added
+// as well, a remain field allows further properties of s.
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool, s, properties map[string]any, required *[]string) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("mapstructure")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+
+		_, opts, _ := strings.Cut(tag, ",")
+		flags := strings.Split(opts, ",")
+
+		switch {
+		case slices.Contains(flags, "squash") && f.Type.Kind() == reflect.Struct:
+			if err := structSchema(f.Type, visiting, s, properties, required); err != nil {
+				return err
+			}
+
+			continue
+		case slices.Contains(flags, "remain"):
+			s["additionalProperties"] = true
+			continue
+		case !f.IsExported():
+			continue
+		}
+
+		field, err := schemaOf(f.Type, visiting)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+
+		name := fieldName(f)
+		properties[name] = field
+
+		if !slices.Contains(flags, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+
+	return nil
+}
+
+// nullable returns s allowing null as well.
+func nullable(s map[string]any) map[string]any {
+	switch typ := s["type"].(type) {
+	case string:
+		s["type"] = []string{typ, "null"}
+	case []string:
+		s["type"] = append(typ, "null")
+	default:
+		if len(s) > 0 {
+			return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+		}
+	}
+
+	return s
+}
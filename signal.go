@@ -0,0 +1,55 @@
+package fxconfig
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// WithSignalReload returns an fx.Option which reloads the Dynamic Config of T
+// when the process receives one of sig, syscall.SIGHUP by default. The signal
+// handler is installed when the app starts and removed when it stops.
+//
+// The file watcher already reloads changed files, a signal forces a reload
+// in addition, e.g. for sources the watcher misses. Reloading an unchanged
+// config is harmless: it is not committed again and reload callbacks are not
+// called, so a signal after a watched change doesn't reload twice.
+func WithSignalReload[T any](sig ...os.Signal) fx.Option {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+
+	return fx.Invoke(func(lc fx.Lifecycle, dyn config.Dynamic[T]) error {
+		d, err := asDynamic(dyn)
+		if err != nil {
+			return err
+		}
+
+		signals := make(chan os.Signal, 1)
+		done := make(chan struct{})
+
+		lc.Append(fx.StartStopHook(
+			func() {
+				signal.Notify(signals, sig...)
+
+				go func() {
+					defer close(done)
+
+					for range signals {
+						_ = d.safeReload() // errors are logged by Reload
+					}
+				}()
+			},
+			func() {
+				signal.Stop(signals)
+				close(signals)
+				<-done
+			},
+		))
+
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package fxconfig
+
+import (
+	"fmt"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// WithStartupHook is an option to verify and log the config in an OnStart
+// hook instead of when it is constructed. The hook validates the config in
+// use again by the validators of WithValidator and logs it to the logger of
+// WithStartupLog, which then doesn't log at construction anymore. If the
+// config is invalid, the start of the app fails.
+//
+// fx calls the constructors lazily, when a value they provide is needed
+// first, and runs the OnStart hooks in the order they were registered. The
+// hook is registered by the constructor of the config, and constructors
+// depending on the config run after it, so the hook runs before the OnStart
+// hooks of all of them: the config is verified and logged, then servers
+// depending on it start. Hooks of constructors not depending on the config
+// may be registered earlier, and a config nobody depends on is not
+// constructed at all, so fx.Invoke a consumer to order it first.
+//
+// The hook needs a managed constructor, i.e. NewManaged, Module, NewNamed or
+// NewGroup. Constructors without the fx lifecycle, i.e. New, NewE,
+// NewWithContext and NewValue, fail with the option.
+func WithStartupHook[T any]() config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.startupHook = true
+	})
+}
+
+// startupHook registers the OnStart hook of WithStartupHook at lc.
+func (d *Dynamic[T]) startupHook(lc fx.Lifecycle) {
+	if !d.opts.startupHook {
+		return
+	}
+
+	lc.Append(fx.StartHook(func() error {
+		s := d.current.Load()
+		if err := d.opts.validate(s.value); err != nil {
+			return fmt.Errorf("fxconfig: %s: invalid config at startup: %w", d.opts.label(), err)
+		}
+
+		d.opts.logLoaded(s.generation, s.value)
+
+		return nil
+	}))
+}
@@ -0,0 +1,67 @@
+package fxconfig
+
+import (
+	"log/slog"
+
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// Static returns an fx.Option which provides value as config of T. It works
+// like Module, including the ConfigDescriptor, but without a config source:
+// Load always returns value. Static does no file I/O, starts no watcher and
+// registers no lifecycle hooks, which makes it handy in tests:
+//
+//	fxtest.New(t, fxconfig.Static(ServiceConfig{URL: "test"}), fx.Invoke(NewService))
+func Static[T any](value T) fx.Option {
+	return provideStatic(func() *Dynamic[T] { return newStatic(value) })
+}
+
+// Disabled returns an fx.Option which provides the zero value of T as config
+// of T like Static, for a feature which is turned off at build or deploy
+// time. Its constructors keep their dependencies satisfied without
+// conditional wiring, and see an obviously empty config:
+//
+//	if !cfg.SearchEnabled {
+//		opts = append(opts, fxconfig.Disabled[SearchConfig]())
+//	}
+//
+// Like Static, it reads no file, starts no watcher and registers no
+// lifecycle hooks. It logs once that the config is disabled, when the config
+// is constructed.
+func Disabled[T any]() fx.Option {
+	return provideStatic(func() *Dynamic[T] {
+		var zero T
+
+		slog.Info("Config disabled, using the zero config", "config", typeName[T]())
+
+		return newStatic(zero)
+	})
+}
+
+// provideStatic provides the static Dynamic Config of newDynamic like Static.
+func provideStatic[T any](newDynamic func() *Dynamic[T]) fx.Option {
+	return fx.Options(
+		fx.Provide(
+			func() (config.Dynamic[T], T) {
+				d := newDynamic()
+				return d, d.Load()
+			},
+			AsLoader[T],
+			asDynamic[T],
+			NewHealth[T],
+			NewStatus[T],
+		),
+		WithDescriptor[T](),
+	)
+}
+
+// newStatic returns a Dynamic Config of value without a source. Reloading it
+// does nothing.
+func newStatic[T any](value T) *Dynamic[T] {
+	d := &Dynamic[T]{opts: &options[T]{}}
+	d.current.Store(&snapshot[T]{value: value, generation: 1})
+	d.loaded()
+
+	return d
+}
@@ -0,0 +1,84 @@
+package fxconfig
+
+import (
+	"strings"
+	"time"
+
+	"schneider.vip/config"
+)
+
+// Status summarizes the state of the Dynamic Config of T in one value for
+// diagnostics, e.g. a /debug/config page. It is provided by Module, with
+// other constructors use fx.Provide(fxconfig.NewStatus[T]). Reading it takes
+// no lock: the state is swapped atomically by the loads, reloads and the
+// file watcher. Use View to read several fields of the same point in time,
+// the accessors read the latest state each.
+type Status[T any] struct {
+	d *Dynamic[T]
+}
+
+// StatusView is a point-in-time view of a Status.
+type StatusView struct {
+	Name       string    // of the config, see Dynamic.Name
+	Generation uint64    // of the config in use
+	LastReload time.Time // of the last successful load or reload
+	LastError  error     // of the last reload, if it failed
+	Watching   bool      // whether the config source is watched for changes
+	Source     string    // the config files or directory, empty for others
+}
+
+// NewStatus returns the Status of the Dynamic Config dyn.
+func NewStatus[T any](dyn config.Dynamic[T]) (*Status[T], error) {
+	d, err := asDynamic(dyn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status[T]{d: d}, nil
+}
+
+// View returns the state of the config at one point in time.
+func (s *Status[T]) View() StatusView {
+	h := s.d.state()
+
+	return StatusView{
+		Name:       s.d.opts.label(),
+		Generation: h.generation,
+		LastReload: h.loaded,
+		LastError:  h.err,
+		Watching:   h.watching,
+		Source:     h.source,
+	}
+}
+
+// Generation returns the generation of the config in use, like
+// Dynamic.Generation.
+func (s *Status[T]) Generation() uint64 { return s.d.state().generation }
+
+// LastReload returns the time of the last successful load or reload.
+func (s *Status[T]) LastReload() time.Time { return s.d.state().loaded }
+
+// LastError returns the error of the last reload, or nil if it succeeded.
+func (s *Status[T]) LastError() error { return s.d.state().err }
+
+// Watching reports whether the file watcher or poller of the config is
+// running. It is false for configs which aren't watched, e.g. read from a
+// reader or with WithStatic, and after Close.
+func (s *Status[T]) Watching() bool { return s.d.state().watching }
+
+// Source returns the config files, separated by ", ", or the directory of
+// NewFromDir, from which the config was loaded. It is empty for configs not
+// read from files.
+func (s *Status[T]) Source() string { return s.d.state().source }
+
+// source returns the identifier of the config source for the Status.
+func (d *Dynamic[T]) source() string {
+	switch {
+	case d.viper == nil:
+		return ""
+	case d.dir() != "":
+		return d.dir()
+	}
+
+	return strings.Join(d.files(), ", ")
+}
@@ -0,0 +1,78 @@
+package fxconfig
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"schneider.vip/config"
+)
+
+// SwitchSource re-points the Dynamic Config at the config source of opts,
+// e.g. another config file after a blue/green switch of the config. Unlike
+// Reload, which reads the same source again, it replaces the source: opts
+// are the options of the config package defining it, like
+// config.WithConfigFile and config.WithSubSection, and the default file
+// config.yml is read without a source option, like by New. The fxconfig
+// options of the constructor stay in effect, those in opts are ignored.
+//
+// The file watcher is stopped, the config is loaded from the new source and
+// the watcher is restarted on the new files. The new config is committed
+// like by a reload: Load returns the old config until the new one is
+// committed as the next generation in one atomic swap, and the reload
+// callbacks are called. If the new source can't be read or its config is
+// invalid, SwitchSource returns the error and the old source and config stay
+// in use, without applying the reload failure policy. A config which is
+// closed, static, derived by Map or Field or a section of NewGroup can't
+// switch its source.
+func (d *Dynamic[T]) SwitchSource(opts ...config.Option[T]) error {
+	if d.loader == nil || d.opts.static || d.group != nil {
+		return errors.New("fxconfig: switch source: config has no source to switch")
+	}
+
+	// The new source is read like by the constructor. Its default config
+	// decides whether fxconfig decodes the config, it must not differ.
+	o := &options[T]{
+		def:         d.opts.def,
+		optional:    d.opts.optional,
+		decodeHooks: d.opts.decodeHooks,
+		strictKeys:  d.opts.strictKeys,
+		requireFile: true,
+	}
+	v := viper.NewWithOptions(viper.KeyDelimiter("_"))
+
+	l, raw, err := newLoader(v, o, opts)
+	if err != nil {
+		return fmt.Errorf("fxconfig: switch source: %w", err)
+	}
+
+	d.switchMu.Lock()
+	defer d.switchMu.Unlock()
+
+	if d.closed {
+		return errors.New("fxconfig: switch source: config is closed")
+	}
+
+	d.stopWatcher()
+
+	if d.watchCtx != nil {
+		defer d.startWatcher(d.watchCtx)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	loader, v0, section, sources := d.loader, d.viper, d.section, d.sources
+	d.loader, d.viper, d.section, d.sources = l, v, loaderSection(l), nil
+
+	value, err := d.build()
+	if err != nil {
+		d.loader, d.viper, d.section, d.sources = loader, v0, section, sources
+		return fmt.Errorf("fxconfig: switch source: %w", err)
+	}
+
+	d.store(value, raw)
+	d.notifyChange(nil)
+
+	return nil
+}
@@ -0,0 +1,351 @@
+package fxconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/fx"
+	"schneider.vip/config"
+)
+
+// watch starts watching the config files and reloads the config on changes,
+// until Close is called or ctx is done, which closes d. A config read from a
+// reader is not watched. Like viper.WatchConfig, the directory of a file is
+// watched, so editors replacing the file and symlink swaps (Kubernetes
+// ConfigMaps) are noticed as well. The directory of NewFromDir is watched
+// as a whole. With WithPollInterval, the files are polled instead. The error
+// sink, if any, is started as well. A config with WithStatic or a closed
+// config is not watched.
+func (d *Dynamic[T]) watch(ctx context.Context) {
+	if d.opts.static {
+		return
+	}
+
+	d.switchMu.Lock()
+	defer d.switchMu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	// When ctx is done, the watcher and the error sink are stopped like by
+	// Close, so no goroutine outlives ctx.
+	defer context.AfterFunc(ctx, func() { d.Close() })
+
+	d.startErrorSink()
+
+	d.watchCtx = ctx
+	d.startWatcher(ctx)
+}
+
+// startWatcher starts the file watcher or poller of the config files, until
+// stopWatcher is called or ctx is done.
+func (d *Dynamic[T]) startWatcher(ctx context.Context) {
+	d.watchErr = nil
+
+	files, dir := d.files(), d.dir()
+	if len(files) == 0 && dir == "" {
+		d.watchErr = errors.New("fxconfig: config is not read from a file, it can't be watched")
+		return
+	}
+
+	for i, file := range files {
+		files[i] = filepath.Clean(file)
+	}
+
+	var n *notifier
+	if interval := d.opts.pollInterval; interval > 0 {
+		paths := files
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+
+		n = newPoller(paths, interval).notifier()
+	} else if n = d.watchFiles(files, dir); n == nil {
+		return
+	}
+
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	d.setHealth(func(h *health) { h.watching = true })
+
+	go d.watchLoop(ctx, n, files, dir)
+}
+
+// stopWatcher stops the file watcher or poller, if running, after it
+// reloaded a pending change. d.mu must not be held, the reload locks it.
+func (d *Dynamic[T]) stopWatcher() {
+	if d.stop == nil {
+		return
+	}
+
+	close(d.stop)
+	<-d.done
+	d.stop, d.done = nil, nil
+}
+
+// watchFiles returns a notifier of files and of the directory dir, if set,
+// by native file system notifications, or nil if they can't be watched.
+func (d *Dynamic[T]) watchFiles(files []string, dir string) *notifier {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Failed to create config watcher", "config", d.opts.label(), "error", err)
+		d.reportError(err)
+		d.watchErr = fmt.Errorf("fxconfig: failed to create config watcher: %w", err)
+
+		return nil
+	}
+
+	dirs := make(map[string]bool)
+
+	if dir != "" {
+		dirs[dir] = true
+
+		if err := w.Add(dir); err != nil {
+			slog.Error("Failed to watch config dir", "config", d.opts.label(), "dir", dir, "error", err)
+			d.reportError(err)
+			d.watchErr = fmt.Errorf("fxconfig: failed to watch config dir %s: %w", dir, err)
+			w.Close()
+
+			return nil
+		}
+	}
+
+	for _, file := range files {
+		if dir := filepath.Dir(file); !dirs[dir] {
+			dirs[dir] = true
+
+			if err := w.Add(dir); err != nil {
+				slog.Error("Failed to watch config", "config", d.opts.label(), "file", file, "error", err)
+				d.reportError(err)
+				d.watchErr = fmt.Errorf("fxconfig: failed to watch config %s: %w", file, err)
+				w.Close()
+
+				return nil
+			}
+		}
+	}
+
+	return &notifier{events: w.Events, errors: w.Errors, close: w.Close}
+}
+
+func (d *Dynamic[T]) watchLoop(ctx context.Context, n *notifier, files []string, dir string) {
+	defer close(d.done)
+	defer d.setHealth(func(h *health) { h.watching = false })
+	defer n.close()
+
+	realFiles := make([]string, len(files))
+	for i, file := range files {
+		realFiles[i], _ = filepath.EvalSymlinks(file)
+	}
+
+	// changed reports whether event changed one of the files. Any change
+	// in dir counts, a reload of an equal config commits nothing.
+	changed := func(event fsnotify.Event) bool {
+		name := filepath.Clean(event.Name)
+		changed := dir != "" && (name == dir || filepath.Dir(name) == dir)
+
+		for i, file := range files {
+			currentFile, _ := filepath.EvalSymlinks(file)
+			written := name == file &&
+				(event.Has(fsnotify.Write) || event.Has(fsnotify.Create))
+			swapped := currentFile != "" && currentFile != realFiles[i]
+
+			if written || swapped {
+				realFiles[i] = currentFile
+				changed = true
+			}
+		}
+
+		return changed
+	}
+
+	// With a debounce, changes are collected until the debounce timer fires.
+	// With a minimum reload interval, a change within the interval waits for
+	// the throttle timer.
+	var (
+		debounceTimer, throttleTimer *time.Timer
+		debounced, throttled         <-chan time.Time
+		last                         time.Time
+	)
+
+	defer func() {
+		for _, timer := range []*time.Timer{debounceTimer, throttleTimer} {
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}()
+
+	// The reloads, including the reload callbacks, run in a worker, so
+	// the events are read on while a slow callback runs. The changes
+	// arriving meanwhile collapse into one pending reload, which reads the
+	// latest state when the running one finished.
+	pending := make(chan struct{}, 1)
+	worker := make(chan struct{})
+
+	go func() {
+		defer close(worker)
+
+		for range pending {
+			d.safeReload()
+		}
+	}()
+
+	defer func() {
+		close(pending)
+		<-worker
+	}()
+
+	reload := func() {
+		select {
+		case pending <- struct{}{}:
+		default:
+		}
+
+		last = time.Now()
+	}
+
+	// apply reloads a change, unless it must wait for the interval. A
+	// waiting reload reads the latest state, so later changes collapse.
+	apply := func() {
+		if throttled != nil {
+			return
+		}
+
+		wait := d.opts.minReloadInterval - time.Since(last)
+		if wait <= 0 {
+			reload()
+			return
+		}
+
+		throttleTimer = time.NewTimer(wait)
+		throttled = throttleTimer.C
+	}
+
+	// flush reloads a pending change before the watcher stops.
+	flush := func() {
+		if debounced != nil || throttled != nil {
+			reload()
+		}
+	}
+
+	for {
+		select {
+		case <-d.stop:
+			flush()
+			return
+		case <-ctx.Done():
+			flush()
+			return
+		case <-debounced:
+			debounced = nil
+			apply()
+		case <-throttled:
+			throttled = nil
+			reload()
+		case event, ok := <-n.events:
+			if !ok {
+				return
+			}
+
+			if !changed(event) {
+				continue
+			}
+
+			switch debounce := d.opts.debounce; {
+			case debounce <= 0:
+				apply()
+			case debounceTimer == nil:
+				debounceTimer = time.NewTimer(debounce)
+				debounced = debounceTimer.C
+			default:
+				debounceTimer.Reset(debounce)
+				debounced = debounceTimer.C
+			}
+		case err, ok := <-n.errors:
+			if !ok {
+				return
+			}
+
+			slog.Error("Config watcher failed", "config", d.opts.label(), "error", err)
+			d.reportError(err)
+		}
+	}
+}
+
+// WithVerifyWatch is an option to fail the start of the app if the config
+// can't be watched, e.g. because the watch of its directory failed or the
+// config is read from a reader. Without it, such a config loads fine but is
+// never reloaded, the failure is only logged. The watch is verified in an
+// OnStart hook, so it requires a managed constructor, i.e. NewManaged,
+// Module, NewNamed or NewGroup, other constructors fail with it. It doesn't
+// apply to a config with WithStatic, which is not watched on purpose.
+func WithVerifyWatch[T any]() config.Option[T] {
+	return newOption(func(o *options[T]) {
+		o.verifyWatch = true
+	})
+}
+
+// verifyWatch registers the OnStart hook of WithVerifyWatch at lc.
+func (d *Dynamic[T]) verifyWatch(lc fx.Lifecycle) {
+	if !d.opts.verifyWatch || d.opts.static {
+		return
+	}
+
+	lc.Append(fx.StartHook(func() error {
+		return d.watchErr
+	}))
+}
+
+// safeReload reloads the config like Reload, but recovers a panic of the
+// reload, e.g. of a validator, so the goroutine calling it keeps running and
+// the last config stays in effect.
+func (d *Dynamic[T]) safeReload() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			err = d.reloadPanicked(r)
+		}
+	}()
+
+	return d.Reload()
+}
+
+// reloadPanicked logs the panic r of a reload with its stack trace and
+// reports it like a failed reload: to the health, the error sink and the
+// observers. It must be called with d.mu held.
+func (d *Dynamic[T]) reloadPanicked(r any) error {
+	err := fmt.Errorf("fxconfig: reload panicked: %v", r)
+
+	slog.Error("Config reload panicked", "config", d.opts.label(), "panic", r, "stack", string(debug.Stack()))
+	d.reloadFailed(err)
+	d.reportError(err)
+	d.observe(func(obs ReloadObserver, config string) { obs.ReloadFailed(config, err) })
+
+	return err
+}
+
+// callbackPanicked logs the panic r of a reload callback with its stack trace
+// and reports it to the error sink and the CallbackObservers. The reload was
+// committed already, so unlike reloadPanicked it leaves the health alone and
+// doesn't count as a failed reload.
+func (d *Dynamic[T]) callbackPanicked(r any) {
+	err := fmt.Errorf("fxconfig: reload callback panicked: %v", r)
+
+	slog.Error("Config reload callback panicked", "config", d.opts.label(), "panic", r, "stack", string(debug.Stack()))
+	d.reportError(err)
+	d.observe(func(obs ReloadObserver, config string) {
+		if obs, ok := obs.(CallbackObserver); ok {
+			obs.CallbackPanicked(config, err)
+		}
+	})
+}